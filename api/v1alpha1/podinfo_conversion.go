@@ -0,0 +1,152 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+)
+
+// specAnnotation keeps the v1beta1 spec of a podinfo that can't be fully expressed in v1alpha1, so that
+// no fields get lost when the podinfo is converted to v1alpha1 and back.
+const specAnnotation = "info.podinfo-operator.io/v1beta1-spec"
+
+var _ conversion.Convertible = &Podinfo{}
+
+// ConvertTo converts this Podinfo to the hub version (v1beta1)
+func (src *Podinfo) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.Podinfo)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = v1beta1.PodinfoSpec{}
+	restored := false
+	if spec, ok := dst.Annotations[specAnnotation]; ok {
+		if err := json.Unmarshal([]byte(spec), &dst.Spec); err != nil {
+			return fmt.Errorf("unable to restore the v1beta1 spec from the %s annotation: %w", specAnnotation, err)
+		}
+		delete(dst.Annotations, specAnnotation)
+		restored = true
+	}
+	convertSpecTo(&src.Spec, &dst.Spec, restored)
+	convertStatusTo(&src.Status, &dst.Status)
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v1beta1) to this version
+func (dst *Podinfo) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.Podinfo)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	delete(dst.Annotations, specAnnotation)
+	dst.Spec = PodinfoSpec{
+		FrontendReplicas: int(src.Spec.Frontend.ReplicaCount()),
+		BackendReplicas:  int(src.Spec.Backend.ReplicaCount()),
+		Message:          src.Spec.Message,
+		DeletionPolicy:   DeletionPolicy(src.Spec.DeletionPolicy),
+	}
+	convertStatusFrom(&src.Status, &dst.Status)
+
+	// keep the original spec around if converting back wouldn't produce it
+	var roundTrip v1beta1.PodinfoSpec
+	convertSpecTo(&dst.Spec, &roundTrip, false)
+	if !equality.Semantic.DeepEqual(roundTrip, src.Spec) {
+		spec, err := json.Marshal(src.Spec)
+		if err != nil {
+			return fmt.Errorf("unable to store the v1beta1 spec in the %s annotation: %w", specAnnotation, err)
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[specAnnotation] = string(spec)
+	}
+	return nil
+}
+
+// convertSpecTo sets the fields of the v1beta1 spec that have a v1alpha1 counterpart, the rest is left
+// untouched. If the v1beta1 spec was restored from the annotation, unset replicas are kept unless they
+// were changed in the meantime.
+func convertSpecTo(src *PodinfoSpec, dst *v1beta1.PodinfoSpec, restored bool) {
+	convertReplicasTo(src.FrontendReplicas, &dst.Frontend, restored)
+	convertReplicasTo(src.BackendReplicas, &dst.Backend, restored)
+	dst.Message = src.Message
+	dst.DeletionPolicy = v1beta1.DeletionPolicy(src.DeletionPolicy)
+}
+
+func convertReplicasTo(replicas int, dst *v1beta1.ComponentSpec, restored bool) {
+	if restored && int(dst.ReplicaCount()) == replicas {
+		return
+	}
+	r := int32(replicas)
+	dst.Replicas = &r
+}
+
+func convertStatusTo(src *PodinfoStatus, dst *v1beta1.PodinfoStatus) {
+	dst.ObservedGeneration = src.ObservedGeneration
+	dst.Conditions = nil
+	for i := range src.Conditions {
+		dst.Conditions = append(dst.Conditions, *src.Conditions[i].DeepCopy())
+	}
+	dst.Frontend = v1beta1.TierStatus(src.Frontend)
+	dst.Backend = v1beta1.TierStatus(src.Backend)
+	dst.Cache = nil
+	if src.Cache != nil {
+		cache := v1beta1.TierStatus(*src.Cache)
+		dst.Cache = &cache
+	}
+	dst.URL = src.URL
+	dst.FaultInjection = nil
+	if faults := src.FaultInjection; faults != nil {
+		dst.FaultInjection = &v1beta1.FaultInjectionStatus{
+			Active:          faults.Active,
+			NextWindowStart: faults.NextWindowStart.DeepCopy(),
+		}
+		if window := faults.LastWindow; window != nil {
+			dst.FaultInjection.LastWindow = &v1beta1.FaultInjectionWindow{Start: window.Start, End: window.End.DeepCopy()}
+		}
+	}
+}
+
+func convertStatusFrom(src *v1beta1.PodinfoStatus, dst *PodinfoStatus) {
+	dst.ObservedGeneration = src.ObservedGeneration
+	dst.Conditions = nil
+	for i := range src.Conditions {
+		dst.Conditions = append(dst.Conditions, *src.Conditions[i].DeepCopy())
+	}
+	dst.Frontend = TierStatus(src.Frontend)
+	dst.Backend = TierStatus(src.Backend)
+	dst.Cache = nil
+	if src.Cache != nil {
+		cache := TierStatus(*src.Cache)
+		dst.Cache = &cache
+	}
+	dst.URL = src.URL
+	dst.FaultInjection = nil
+	if faults := src.FaultInjection; faults != nil {
+		dst.FaultInjection = &FaultInjectionStatus{
+			Active:          faults.Active,
+			NextWindowStart: faults.NextWindowStart.DeepCopy(),
+		}
+		if window := faults.LastWindow; window != nil {
+			dst.FaultInjection.LastWindow = &FaultInjectionWindow{Start: window.Start, End: window.End.DeepCopy()}
+		}
+	}
+}
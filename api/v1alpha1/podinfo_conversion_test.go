@@ -0,0 +1,137 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"k8s.io/utils/pointer"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+)
+
+const fuzzIterations = 1000
+
+func newFuzzer() *fuzz.Fuzzer {
+	return fuzz.New().NilChance(0.3).Funcs(
+		// the type meta is set by the conversion webhook, not by the conversion functions
+		func(m *metav1.TypeMeta, c fuzz.Continue) {},
+		// random quantities can't be serialized, the v1beta1 spec is kept as JSON in the annotation
+		func(q *resource.Quantity, c fuzz.Continue) {
+			*q = *resource.NewQuantity(c.Int63n(1000), resource.DecimalSI)
+		},
+		func(s *PodinfoSpec, c fuzz.Continue) {
+			c.FuzzNoCustom(s)
+			// v1beta1 uses int32 replicas
+			s.FrontendReplicas = int(int32(c.Uint32()))
+			s.BackendReplicas = int(int32(c.Uint32()))
+		},
+	)
+}
+
+func TestFuzzyConversionFromSpoke(t *testing.T) {
+	f := newFuzzer()
+	for i := 0; i < fuzzIterations; i++ {
+		original := &Podinfo{}
+		f.Fuzz(original)
+
+		hub := &v1beta1.Podinfo{}
+		if err := original.ConvertTo(hub); err != nil {
+			t.Fatalf("unable to convert to the hub: %v", err)
+		}
+		converted := &Podinfo{}
+		if err := converted.ConvertFrom(hub); err != nil {
+			t.Fatalf("unable to convert from the hub: %v", err)
+		}
+		if !apiequality.Semantic.DeepEqual(original, converted) {
+			t.Fatalf("round trip changed the podinfo: %s", diff.ObjectReflectDiff(original, converted))
+		}
+	}
+}
+
+func TestFuzzyConversionFromHub(t *testing.T) {
+	f := newFuzzer()
+	for i := 0; i < fuzzIterations; i++ {
+		original := &v1beta1.Podinfo{}
+		f.Fuzz(original)
+
+		spoke := &Podinfo{}
+		if err := spoke.ConvertFrom(original); err != nil {
+			t.Fatalf("unable to convert from the hub: %v", err)
+		}
+		converted := &v1beta1.Podinfo{}
+		if err := spoke.ConvertTo(converted); err != nil {
+			t.Fatalf("unable to convert to the hub: %v", err)
+		}
+		if !apiequality.Semantic.DeepEqual(original, converted) {
+			t.Fatalf("round trip changed the podinfo: %s", diff.ObjectReflectDiff(original, converted))
+		}
+	}
+}
+
+func TestConversion(t *testing.T) {
+	hub := &v1beta1.Podinfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default"},
+		Spec: v1beta1.PodinfoSpec{
+			Frontend:       v1beta1.ComponentSpec{Replicas: pointer.Int32Ptr(3)},
+			Backend:        v1beta1.ComponentSpec{Replicas: pointer.Int32Ptr(2)},
+			Message:        "Hello Podinfo",
+			DeletionPolicy: v1beta1.DeletionPolicyOrphan,
+		},
+	}
+
+	spoke := &Podinfo{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	expected := PodinfoSpec{FrontendReplicas: 3, BackendReplicas: 2, Message: "Hello Podinfo", DeletionPolicy: DeletionPolicyOrphan}
+	if spoke.Spec != expected {
+		t.Errorf("expected %+v, got %+v", expected, spoke.Spec)
+	}
+	if _, ok := spoke.Annotations[specAnnotation]; ok {
+		t.Errorf("the spec can be expressed in v1alpha1, there should be no %s annotation", specAnnotation)
+	}
+
+	// unset replicas can't be expressed in v1alpha1
+	hub.Spec.Backend.Replicas = nil
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if spoke.Spec.BackendReplicas != int(v1beta1.DefaultReplicas) {
+		t.Errorf("expected %d backend replicas, got %d", v1beta1.DefaultReplicas, spoke.Spec.BackendReplicas)
+	}
+	if _, ok := spoke.Annotations[specAnnotation]; !ok {
+		t.Errorf("expected the spec to be kept in the %s annotation", specAnnotation)
+	}
+
+	// changes made in v1alpha1 win over the annotation
+	spoke.Spec.BackendReplicas = 5
+	if err := spoke.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if hub.Spec.Backend.Replicas == nil || *hub.Spec.Backend.Replicas != 5 {
+		t.Errorf("expected 5 backend replicas, got %v", hub.Spec.Backend.Replicas)
+	}
+	if _, ok := hub.Annotations[specAnnotation]; ok {
+		t.Errorf("the %s annotation should not leak into v1beta1", specAnnotation)
+	}
+}
@@ -28,19 +28,104 @@ type PodinfoSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	FrontendReplicas int    `json:"frontend-replicas,omitempty"`
-	BackendReplicas  int    `json:"backend-replicas,omitempty"`
-	Message          string `json:"message,omitempty"`
+	// +kubebuilder:default=1
+	FrontendReplicas int `json:"frontend-replicas,omitempty"`
+	// +kubebuilder:default=1
+	BackendReplicas int    `json:"backend-replicas,omitempty"`
+	Message         string `json:"message,omitempty"`
+
+	// DeletionPolicy says what happens with the deployments and services when the podinfo is deleted.
+	// Delete (default) removes them, Orphan keeps them running and only releases them from the podinfo.
+	// +kubebuilder:validation:Enum=Delete;Orphan
+	// +kubebuilder:default=Delete
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// DeletionPolicy describes how the generated objects are handled when the podinfo is deleted
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the deployments and services together with the podinfo
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyOrphan keeps the deployments and services running after the podinfo is deleted
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
+// TierStatus defines the observed state of a single podinfo tier (frontend, backend or cache)
+type TierStatus struct {
+	// Replicas is the desired number of replicas of the tier.
+	Replicas int32 `json:"replicas,omitempty"`
+	// ReadyReplicas is the number of ready pods of the tier.
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// Ready is a human readable form of the readiness, e.g. "1/2".
+	Ready string `json:"ready,omitempty"`
+	// Version is the podinfo version the tier runs, it's updated once a rollout completes.
+	Version string `json:"version,omitempty"`
 }
 
 // PodinfoStatus defines the observed state of Podinfo
 type PodinfoStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// ObservedGeneration is the most recent generation observed by the operator.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represent the latest available observations of the podinfo state.
+	// Known condition types are Ready, Progressing, Degraded and Stalled.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Frontend is the observed state of the frontend (-fe) deployment.
+	Frontend TierStatus `json:"frontend,omitempty"`
+
+	// Backend is the observed state of the backend (-be) deployment.
+	Backend TierStatus `json:"backend,omitempty"`
+
+	// Cache is the observed state of the cache (-cache) deployment, it's only reported when the cache is enabled.
+	// +optional
+	Cache *TierStatus `json:"cache,omitempty"`
+
+	// URL the frontend is exposed on by the ingress.
+	URL string `json:"url,omitempty"`
+
+	// FaultInjection is the state of the fault injection, it's only reported when the fault injection is enabled.
+	// +optional
+	FaultInjection *FaultInjectionStatus `json:"faultInjection,omitempty"`
+}
+
+// FaultInjectionStatus defines the observed state of the fault injection
+type FaultInjectionStatus struct {
+	// Active is true while the faults are injected.
+	Active bool `json:"active"`
+
+	// LastWindow is the current active window or the last one that ended.
+	// +optional
+	LastWindow *FaultInjectionWindow `json:"lastWindow,omitempty"`
+
+	// NextWindowStart is when the next active window starts, it's empty if the faults are active all the time.
+	// +optional
+	NextWindowStart *metav1.Time `json:"nextWindowStart,omitempty"`
+}
+
+// FaultInjectionWindow is a period of time the faults are injected in
+type FaultInjectionWindow struct {
+	// Start of the window.
+	Start metav1.Time `json:"start"`
+
+	// End of the window, it's empty if the faults are active all the time.
+	// +optional
+	End *metav1.Time `json:"end,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Frontend",type=string,JSONPath=`.status.frontend.ready`
+//+kubebuilder:printcolumn:name="Backend",type=string,JSONPath=`.status.backend.ready`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Podinfo is the Schema for the podinfoes API
 type Podinfo struct {
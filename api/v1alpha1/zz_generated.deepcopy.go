@@ -21,16 +21,61 @@ limitations under the License.
 package v1alpha1
 
 import (
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FaultInjectionStatus) DeepCopyInto(out *FaultInjectionStatus) {
+	*out = *in
+	if in.LastWindow != nil {
+		in, out := &in.LastWindow, &out.LastWindow
+		*out = new(FaultInjectionWindow)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NextWindowStart != nil {
+		in, out := &in.NextWindowStart, &out.NextWindowStart
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FaultInjectionStatus.
+func (in *FaultInjectionStatus) DeepCopy() *FaultInjectionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FaultInjectionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FaultInjectionWindow) DeepCopyInto(out *FaultInjectionWindow) {
+	*out = *in
+	in.Start.DeepCopyInto(&out.Start)
+	if in.End != nil {
+		in, out := &in.End, &out.End
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FaultInjectionWindow.
+func (in *FaultInjectionWindow) DeepCopy() *FaultInjectionWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(FaultInjectionWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Podinfo) DeepCopyInto(out *Podinfo) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Podinfo.
@@ -101,6 +146,25 @@ func (in *PodinfoSpec) DeepCopy() *PodinfoSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodinfoStatus) DeepCopyInto(out *PodinfoStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	out.Frontend = in.Frontend
+	out.Backend = in.Backend
+	if in.Cache != nil {
+		in, out := &in.Cache, &out.Cache
+		*out = new(TierStatus)
+		**out = **in
+	}
+	if in.FaultInjection != nil {
+		in, out := &in.FaultInjection, &out.FaultInjection
+		*out = new(FaultInjectionStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodinfoStatus.
@@ -112,3 +176,18 @@ func (in *PodinfoStatus) DeepCopy() *PodinfoStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TierStatus) DeepCopyInto(out *TierStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TierStatus.
+func (in *TierStatus) DeepCopy() *TierStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TierStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,700 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"bytes"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+// PodinfoSpec defines the desired state of Podinfo
+type PodinfoSpec struct {
+	// Frontend configures the frontend (-fe) tier.
+	// +optional
+	Frontend ComponentSpec `json:"frontend,omitempty"`
+
+	// Backend configures the backend (-be) tier.
+	// +optional
+	Backend ComponentSpec `json:"backend,omitempty"`
+
+	// Cache deploys a Redis cache (-cache) as a third tier and configures the backend to use it.
+	// +optional
+	Cache *CacheSpec `json:"cache,omitempty"`
+
+	// Version is the podinfo version (image tag) of both tiers, the version the operator is configured
+	// with is used if empty. On upgrades the backend is rolled out first, the frontend follows once
+	// the backend is available.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Ingress exposes the frontend outside of the cluster, no ingress is created if empty.
+	// +optional
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+
+	// NetworkPolicy restricts the traffic to the pods of both tiers, no network policies are created if empty.
+	// +optional
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+
+	// Monitoring makes Prometheus Operator scrape the metrics of both tiers and optionally alert on them,
+	// nothing is created if empty. It requires the monitoring.coreos.com CRDs.
+	// +optional
+	Monitoring *MonitoringSpec `json:"monitoring,omitempty"`
+
+	// Message is the message shown in the podinfo UI.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// UI customizes the podinfo UI of both tiers.
+	// +optional
+	UI *UISpec `json:"ui,omitempty"`
+
+	// FaultInjection turns podinfo's fault injection on in the active windows of its schedule, e.g. to test
+	// the resilience of a service mesh or the alerting. The tiers are rolled out when a window starts and ends.
+	// +optional
+	FaultInjection *FaultInjectionSpec `json:"faultInjection,omitempty"`
+
+	// DeletionPolicy says what happens with the deployments and services when the podinfo is deleted.
+	// Delete (default) removes them, Orphan keeps them running and only releases them from the podinfo.
+	// +kubebuilder:validation:Enum=Delete;Orphan
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// ComponentSpec defines the desired state of a single podinfo tier
+type ComponentSpec struct {
+	// Replicas is the desired number of pods of the tier, defaults to 1. It's ignored when the
+	// tier is autoscaled.
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Autoscaling scales the tier by a HorizontalPodAutoscaler instead of the fixed number of replicas.
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// PodDisruptionBudget limits the voluntary disruptions (e.g. node drains) of the tier's pods,
+	// no budget is created if empty.
+	// +optional
+	PodDisruptionBudget *PodDisruptionBudgetSpec `json:"podDisruptionBudget,omitempty"`
+
+	// Image overrides the podinfo image of the tier, e.g. to pull it from a private registry.
+	// It takes precedence over the version.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// ImagePullPolicy of the podinfo container.
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	// +optional
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// ImagePullSecrets are references to secrets in the namespace of the podinfo used for pulling the image.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// Resources of the podinfo container, they replace the default requests and limits of the tier.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// NodeSelector of the tier's pods.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the tier's pods.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity of the tier's pods.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// TopologySpreadConstraints of the tier's pods.
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// Config are the settings of the podinfo server of the tier, passed to podinfo as flags.
+	// +optional
+	Config *PodinfoConfig `json:"config,omitempty"`
+
+	// Env are additional environment variables of the podinfo container, they take precedence over the
+	// variables set by the operator (e.g. PODINFO_UI_COLOR). The tier is rolled out when a ConfigMap or
+	// a Secret the variables refer to changes.
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// EnvFrom are additional sources of environment variables of the podinfo container. The tier is rolled
+	// out when one of the ConfigMaps or Secrets changes.
+	// +optional
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+
+	// Patches are applied in order to the Deployment and the Service generated for the tier before they
+	// are sent to the API server, e.g. to add sidecars, volumes or annotations. The name, namespace, owner
+	// and selector of the objects can't be patched.
+	// +optional
+	Patches []Patch `json:"patches,omitempty"`
+}
+
+// UISpec customizes the podinfo UI
+type UISpec struct {
+	// Color of the UI, "#34577c" by default.
+	// +kubebuilder:validation:Pattern=`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`
+	// +optional
+	Color string `json:"color,omitempty"`
+
+	// LogoURL is the http(s) URL of the logo shown in the UI.
+	// +optional
+	LogoURL string `json:"logoURL,omitempty"`
+
+	// Path is the path of the UI assets in the podinfo container, e.g. of a custom UI mounted by a patch.
+	// +kubebuilder:validation:Pattern=`^/`
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// PatchTarget is the kind of the generated object a patch is applied to
+// +kubebuilder:validation:Enum=Deployment;Service
+type PatchTarget string
+
+const (
+	// PatchTargetDeployment patches the deployment of the tier
+	PatchTargetDeployment PatchTarget = "Deployment"
+	// PatchTargetService patches the service of the tier
+	PatchTargetService PatchTarget = "Service"
+)
+
+// Patch is a kustomize-style patch of an object generated for a tier
+type Patch struct {
+	// Target is the kind of the generated object the patch is applied to.
+	Target PatchTarget `json:"target"`
+
+	// Patch is either a strategic merge patch (an object) or an RFC 6902 JSON patch (a list of
+	// operations), in YAML or JSON.
+	// +kubebuilder:validation:MinLength=1
+	Patch string `json:"patch"`
+}
+
+// Decode returns the patch in JSON, the returned bool is true for an RFC 6902 JSON patch and false for
+// a strategic merge patch
+func (p *Patch) Decode() ([]byte, bool, error) {
+	data, err := yaml.YAMLToJSON([]byte(p.Patch))
+	if err != nil {
+		return nil, false, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		patch, err := jsonpatch.DecodePatch(trimmed)
+		if err != nil {
+			return nil, false, err
+		}
+		for i, op := range patch {
+			if err := validateOperation(op); err != nil {
+				return nil, false, fmt.Errorf("operation %d: %w", i, err)
+			}
+		}
+		return trimmed, true, nil
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return trimmed, false, nil
+	default:
+		return nil, false, fmt.Errorf("must be an object (strategic merge patch) or a list of operations (JSON patch)")
+	}
+}
+
+// validateOperation checks the operation of a JSON patch has a known kind and the paths the kind needs
+func validateOperation(op jsonpatch.Operation) error {
+	if _, err := op.Path(); err != nil {
+		return err
+	}
+	switch op.Kind() {
+	case "add", "remove", "replace", "test":
+		return nil
+	case "move", "copy":
+		_, err := op.From()
+		return err
+	default:
+		return fmt.Errorf("unknown op %q", op.Kind())
+	}
+}
+
+// ReplicaCount returns the desired number of replicas of the tier, taking the default into account
+func (c *ComponentSpec) ReplicaCount() int32 {
+	if c.Replicas == nil {
+		return DefaultReplicas
+	}
+	return *c.Replicas
+}
+
+// PodinfoConfig are the settings of the podinfo server of a tier, each of them maps to a podinfo flag
+type PodinfoConfig struct {
+	// Level of the logs (--level), info by default.
+	// +kubebuilder:validation:Enum=debug;info;warn;error
+	// +optional
+	Level string `json:"level,omitempty"`
+
+	// Port of the HTTP server (--port), 9898 by default. The Service of the backend exposes the same port,
+	// the frontend is always exposed on port 80.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+
+	// MetricsPort is the port of the metrics server (--port-metrics), 9797 by default.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	MetricsPort *int32 `json:"metricsPort,omitempty"`
+
+	// GRPCPort is the port of the gRPC server of the backend (--grpc-port), 9999 by default.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	GRPCPort *int32 `json:"grpcPort,omitempty"`
+
+	// H2C enables HTTP/2 without TLS (--h2c).
+	// +optional
+	H2C bool `json:"h2c,omitempty"`
+
+	// DataPath is the path of the data directory of podinfo (--data-path).
+	// +kubebuilder:validation:Pattern=`^/`
+	// +optional
+	DataPath string `json:"dataPath,omitempty"`
+
+	// HTTPServerTimeout is the read and write timeout of the HTTP server (--http-server-timeout).
+	// +optional
+	HTTPServerTimeout *metav1.Duration `json:"httpServerTimeout,omitempty"`
+
+	// HTTPServerShutdownTimeout is the time the HTTP server gets to finish the requests in progress when
+	// podinfo stops (--http-server-shutdown-timeout).
+	// +optional
+	HTTPServerShutdownTimeout *metav1.Duration `json:"httpServerShutdownTimeout,omitempty"`
+
+	// HTTPClientTimeout is the timeout of the calls to the backend (--http-client-timeout).
+	// +optional
+	HTTPClientTimeout *metav1.Duration `json:"httpClientTimeout,omitempty"`
+
+	// RandomDelay delays the responses by a random time (--random-delay).
+	// +optional
+	RandomDelay *RandomDelaySpec `json:"randomDelay,omitempty"`
+
+	// RandomError makes podinfo fail random responses with a 5xx status (--random-error).
+	// +optional
+	RandomError bool `json:"randomError,omitempty"`
+
+	// StressCPU is the number of CPU cores podinfo keeps busy (--stress-cpu).
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	StressCPU int32 `json:"stressCPU,omitempty"`
+
+	// StressMemory is the amount of memory in MB podinfo allocates (--stress-memory).
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	StressMemory int32 `json:"stressMemory,omitempty"`
+}
+
+// RandomDelaySpec is the range of the random delay of the responses
+type RandomDelaySpec struct {
+	// Min is the minimal delay (--random-delay-min), 0 by default.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Min int32 `json:"min,omitempty"`
+
+	// Max is the maximal delay (--random-delay-max), 5 by default.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Max *int32 `json:"max,omitempty"`
+
+	// Unit of the delays (--random-delay-unit), s (default) or ms.
+	// +kubebuilder:validation:Enum=s;ms
+	// +optional
+	Unit string `json:"unit,omitempty"`
+}
+
+// Default ports of the podinfo servers
+const (
+	DefaultPort        int32 = 9898
+	DefaultMetricsPort int32 = 9797
+	DefaultGRPCPort    int32 = 9999
+)
+
+// FrontendServicePort is the port the service of the frontend exposes the HTTP server on, the metrics
+// server of the frontend can't use it
+const FrontendServicePort int32 = 80
+
+// HTTPPort returns the port of the HTTP server, taking the default into account
+func (c *PodinfoConfig) HTTPPort() int32 {
+	if c == nil || c.Port == nil {
+		return DefaultPort
+	}
+	return *c.Port
+}
+
+// MetricsServerPort returns the port of the metrics server, taking the default into account
+func (c *PodinfoConfig) MetricsServerPort() int32 {
+	if c == nil || c.MetricsPort == nil {
+		return DefaultMetricsPort
+	}
+	return *c.MetricsPort
+}
+
+// GRPCServerPort returns the port of the gRPC server, taking the default into account
+func (c *PodinfoConfig) GRPCServerPort() int32 {
+	if c == nil || c.GRPCPort == nil {
+		return DefaultGRPCPort
+	}
+	return *c.GRPCPort
+}
+
+// LogLevel returns the level of the logs, taking the default into account
+func (c *PodinfoConfig) LogLevel() string {
+	if c == nil || c.Level == "" {
+		return "info"
+	}
+	return c.Level
+}
+
+// CacheSpec defines the Redis cache of the backend
+type CacheSpec struct {
+	// Image of the Redis server, the operator's default Redis image is used if empty.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Resources of the Redis container, they replace the default requests and limits.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// AutoscalingSpec defines the HorizontalPodAutoscaler of a podinfo tier. If none of the targets is set,
+// the tier is scaled on 80% CPU utilization.
+type AutoscalingSpec struct {
+	// MinReplicas is the lower limit of the number of replicas, defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas is the upper limit of the number of replicas.
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// TargetCPUUtilizationPercentage is the target average CPU utilization of the pods,
+	// in percent of the requested CPU.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// TargetMemoryUtilizationPercentage is the target average memory utilization of the pods,
+	// in percent of the requested memory.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+
+	// TargetHTTPRequestsPerSecond is the target average rate of podinfo's http_requests_total counter
+	// per pod. It requires a custom metrics adapter (e.g. prometheus-adapter) serving the rate as the
+	// http_requests pods metric.
+	// +optional
+	TargetHTTPRequestsPerSecond *resource.Quantity `json:"targetHTTPRequestsPerSecond,omitempty"`
+}
+
+// PodDisruptionBudgetSpec defines the PodDisruptionBudget of a podinfo tier, exactly one of
+// MinAvailable and MaxUnavailable has to be set
+type PodDisruptionBudgetSpec struct {
+	// MinAvailable is the number (or percentage) of the tier's pods that must stay available
+	// during a disruption.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// MaxUnavailable is the number (or percentage) of the tier's pods that can be unavailable
+	// during a disruption.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// IngressSpec defines the Ingress exposing the frontend (-fe) service
+type IngressSpec struct {
+	// Host is the fully qualified domain name the frontend is served on, all the hosts match if empty.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Path the frontend is served on, defaults to /.
+	// +kubebuilder:validation:Pattern=`^/`
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// IngressClassName is the name of the IngressClass of the ingress controller that should serve the
+	// ingress, the default class of the cluster is used if empty.
+	// +optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+
+	// TLSSecretName is the name of the secret with the TLS certificate for the host, TLS is not enabled
+	// if empty.
+	// +optional
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+
+	// Annotations are added to the ingress, e.g. to configure the ingress controller or cert-manager.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// NetworkPolicySpec defines the NetworkPolicies of the tiers. The backend only accepts the traffic from
+// the frontend pods, the metrics of both tiers can only be scraped from MetricsFrom.
+type NetworkPolicySpec struct {
+	// Enabled turns the network policies on.
+	Enabled bool `json:"enabled"`
+
+	// FrontendFrom are the sources allowed to reach the frontend's http port, e.g. the namespace of the
+	// ingress controller. The frontend is reachable from everywhere if empty.
+	// +optional
+	FrontendFrom []networkingv1.NetworkPolicyPeer `json:"frontendFrom,omitempty"`
+
+	// MetricsFrom are the sources allowed to scrape the http-metrics port (9797) of both tiers, e.g.
+	// the namespace of Prometheus. The metrics aren't reachable from outside of the pods if empty.
+	// +optional
+	MetricsFrom []networkingv1.NetworkPolicyPeer `json:"metricsFrom,omitempty"`
+}
+
+// MonitoringSpec defines the ServiceMonitor and the PrometheusRule of the podinfo
+type MonitoringSpec struct {
+	// Interval at which the metrics are scraped, the default interval of Prometheus is used if empty.
+	// +kubebuilder:validation:Pattern=`^([0-9]+(ms|s|m|h))+$`
+	// +optional
+	Interval string `json:"interval,omitempty"`
+
+	// Labels are added to the ServiceMonitor and the PrometheusRule, e.g. to match the selectors of
+	// the Prometheus instance.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Alerts creates a PrometheusRule alerting on the error rate and the latency of the tiers, no rule
+	// is created if empty.
+	// +optional
+	Alerts *AlertsSpec `json:"alerts,omitempty"`
+}
+
+// AlertsSpec defines the alerting rules of the podinfo
+type AlertsSpec struct {
+	// ErrorRatePercent is the percentage of the 5xx responses of a tier above which the error rate alert
+	// fires, defaults to 5.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	ErrorRatePercent *int32 `json:"errorRatePercent,omitempty"`
+
+	// LatencyThreshold is the 99th percentile of the request duration of a tier above which the latency
+	// alert fires, defaults to 500ms.
+	// +optional
+	LatencyThreshold *metav1.Duration `json:"latencyThreshold,omitempty"`
+
+	// For is how long the condition has to hold before the alerts fire, defaults to 5m.
+	// +optional
+	For *metav1.Duration `json:"for,omitempty"`
+}
+
+// FaultInjectionSpec defines the faults injected into the tiers and when they are active
+type FaultInjectionSpec struct {
+	// Tiers the faults are injected into, Backend (default), Frontend or Both.
+	// +kubebuilder:validation:Enum=Backend;Frontend;Both
+	// +optional
+	Tiers FaultInjectionTiers `json:"tiers,omitempty"`
+
+	// Schedule is a cron expression of the starts of the active windows, e.g. "0 * * * *" for every hour.
+	// It's evaluated in UTC unless it starts with CRON_TZ=<time zone>.
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// Interval starts an active window every interval since the podinfo was created, it can't be combined
+	// with the schedule. The faults are active all the time when neither the schedule nor the interval is set.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Duration of the active windows, required with the schedule or the interval.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// RandomDelay delays the responses by a random time (--random-delay).
+	// +optional
+	RandomDelay *RandomDelaySpec `json:"randomDelay,omitempty"`
+
+	// RandomError makes podinfo fail random responses with a 5xx status (--random-error).
+	// +optional
+	RandomError bool `json:"randomError,omitempty"`
+
+	// StressCPU is the number of CPU cores podinfo keeps busy (--stress-cpu).
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	StressCPU int32 `json:"stressCPU,omitempty"`
+
+	// StressMemory is the amount of memory in MB podinfo allocates (--stress-memory).
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	StressMemory int32 `json:"stressMemory,omitempty"`
+}
+
+// FaultInjectionTiers selects the tiers the faults are injected into
+type FaultInjectionTiers string
+
+const (
+	// FaultInjectionBackend injects the faults into the backend only
+	FaultInjectionBackend FaultInjectionTiers = "Backend"
+	// FaultInjectionFrontend injects the faults into the frontend only
+	FaultInjectionFrontend FaultInjectionTiers = "Frontend"
+	// FaultInjectionBoth injects the faults into both tiers
+	FaultInjectionBoth FaultInjectionTiers = "Both"
+)
+
+// Targets returns true if the faults are injected into the given tier
+func (f *FaultInjectionSpec) Targets(backend bool) bool {
+	switch f.Tiers {
+	case FaultInjectionBoth:
+		return true
+	case FaultInjectionFrontend:
+		return !backend
+	default:
+		return backend
+	}
+}
+
+// DeletionPolicy describes how the generated objects are handled when the podinfo is deleted
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the deployments and services together with the podinfo
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyOrphan keeps the deployments and services running after the podinfo is deleted
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
+// Finalizer is put on every podinfo so that the operator can clean up according to its DeletionPolicy
+const Finalizer = "info.podinfo-operator.io/cleanup"
+
+// Condition types set on Podinfo by the operator.
+const (
+	// ConditionReady is true when all the replicas of all the tiers are ready.
+	ConditionReady = "Ready"
+	// ConditionProgressing is true while any of the tiers is rolling out.
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded is true when the operator failed to reconcile the
+	// podinfo or one of the tiers failed to roll out.
+	ConditionDegraded = "Degraded"
+	// ConditionStalled is true when the reconciliation failed with an error retrying doesn't fix,
+	// e.g. an object generated from the spec was rejected by the API server. The operator doesn't
+	// retry until the podinfo changes.
+	ConditionStalled = "Stalled"
+)
+
+// TierStatus defines the observed state of a single podinfo tier (frontend, backend or cache)
+type TierStatus struct {
+	// Replicas is the desired number of replicas of the tier.
+	Replicas int32 `json:"replicas,omitempty"`
+	// ReadyReplicas is the number of ready pods of the tier.
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// Ready is a human readable form of the readiness, e.g. "1/2".
+	Ready string `json:"ready,omitempty"`
+	// Version is the podinfo version the tier runs, it's updated once a rollout completes.
+	Version string `json:"version,omitempty"`
+}
+
+// PodinfoStatus defines the observed state of Podinfo
+type PodinfoStatus struct {
+	// ObservedGeneration is the most recent generation observed by the operator.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represent the latest available observations of the podinfo state.
+	// Known condition types are Ready, Progressing, Degraded and Stalled.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Frontend is the observed state of the frontend (-fe) deployment.
+	Frontend TierStatus `json:"frontend,omitempty"`
+
+	// Backend is the observed state of the backend (-be) deployment.
+	Backend TierStatus `json:"backend,omitempty"`
+
+	// Cache is the observed state of the cache (-cache) deployment, it's only reported when the cache is enabled.
+	// +optional
+	Cache *TierStatus `json:"cache,omitempty"`
+
+	// URL the frontend is exposed on by the ingress.
+	URL string `json:"url,omitempty"`
+
+	// FaultInjection is the state of the fault injection, it's only reported when the fault injection is enabled.
+	// +optional
+	FaultInjection *FaultInjectionStatus `json:"faultInjection,omitempty"`
+}
+
+// FaultInjectionStatus defines the observed state of the fault injection
+type FaultInjectionStatus struct {
+	// Active is true while the faults are injected.
+	Active bool `json:"active"`
+
+	// LastWindow is the current active window or the last one that ended.
+	// +optional
+	LastWindow *FaultInjectionWindow `json:"lastWindow,omitempty"`
+
+	// NextWindowStart is when the next active window starts, it's empty if the faults are active all the time.
+	// +optional
+	NextWindowStart *metav1.Time `json:"nextWindowStart,omitempty"`
+}
+
+// FaultInjectionWindow is a period of time the faults are injected in
+type FaultInjectionWindow struct {
+	// Start of the window.
+	Start metav1.Time `json:"start"`
+
+	// End of the window, it's empty if the faults are active all the time.
+	// +optional
+	End *metav1.Time `json:"end,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:storageversion
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Frontend",type=string,JSONPath=`.status.frontend.ready`
+//+kubebuilder:printcolumn:name="Backend",type=string,JSONPath=`.status.backend.ready`
+//+kubebuilder:printcolumn:name="Cache",type=string,JSONPath=`.status.cache.ready`,priority=1
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+//+kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.url`,priority=1
+//+kubebuilder:printcolumn:name="Faults",type=boolean,JSONPath=`.status.faultInjection.active`,priority=1
+
+// Podinfo is the Schema for the podinfoes API
+type Podinfo struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PodinfoSpec   `json:"spec,omitempty"`
+	Status PodinfoStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PodinfoList contains a list of Podinfo
+type PodinfoList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Podinfo `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Podinfo{}, &PodinfoList{})
+}
@@ -0,0 +1,332 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	// DefaultMessage is the UI message used when the podinfo doesn't specify any
+	DefaultMessage = "greetings from podinfo"
+	// MaxMessageLength is the maximum length of the UI message
+	MaxMessageLength = 256
+	// DefaultReplicas is the number of replicas of a tier that doesn't specify any
+	DefaultReplicas int32 = 1
+)
+
+// log is for logging in this package.
+var podinfolog = logf.Log.WithName("podinfo-resource")
+
+// SetupWebhookWithManager registers the defaulting and validating webhooks and, as v1beta1 is the hub,
+// also the conversion webhook for the other versions.
+func (r *Podinfo) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-info-podinfo-operator-io-v1beta1-podinfo,mutating=true,failurePolicy=fail,sideEffects=None,groups=info.podinfo-operator.io,resources=podinfoes,verbs=create;update,versions=v1beta1,name=mpodinfo.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Defaulter = &Podinfo{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *Podinfo) Default() {
+	podinfolog.Info("default", "name", r.Name)
+
+	for _, component := range []*ComponentSpec{&r.Spec.Frontend, &r.Spec.Backend} {
+		if component.Replicas == nil {
+			replicas := DefaultReplicas
+			component.Replicas = &replicas
+		}
+	}
+	if r.Spec.Message == "" {
+		r.Spec.Message = DefaultMessage
+	}
+	if r.Spec.DeletionPolicy == "" {
+		r.Spec.DeletionPolicy = DeletionPolicyDelete
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-info-podinfo-operator-io-v1beta1-podinfo,mutating=false,failurePolicy=fail,sideEffects=None,groups=info.podinfo-operator.io,resources=podinfoes,verbs=create;update,versions=v1beta1,name=vpodinfo.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &Podinfo{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Podinfo) ValidateCreate() error {
+	podinfolog.Info("validate create", "name", r.Name)
+
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Podinfo) ValidateUpdate(old runtime.Object) error {
+	podinfolog.Info("validate update", "name", r.Name)
+
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Podinfo) ValidateDelete() error {
+	// nothing to validate upon deletion
+	return nil
+}
+
+func (r *Podinfo) validate() error {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	frontend, backend := r.Spec.Frontend.minReplicas(), r.Spec.Backend.minReplicas()
+
+	if frontend < 0 {
+		errs = append(errs, field.Invalid(spec.Child("frontend", "replicas"), frontend, "must be greater than or equal to 0"))
+	}
+	if backend < 0 {
+		errs = append(errs, field.Invalid(spec.Child("backend", "replicas"), backend, "must be greater than or equal to 0"))
+	}
+	if backend == 0 && frontend > 0 {
+		errs = append(errs, field.Invalid(spec.Child("backend", "replicas"), backend, "must be greater than 0 when the frontend has replicas"))
+	}
+	errs = append(errs, validateComponent(spec.Child("frontend"), &r.Spec.Frontend)...)
+	errs = append(errs, validateComponent(spec.Child("backend"), &r.Spec.Backend)...)
+	if port := r.Spec.Frontend.Config.MetricsServerPort(); port == FrontendServicePort {
+		errs = append(errs, field.Invalid(spec.Child("frontend", "config", "metricsPort"), port,
+			fmt.Sprintf("must be different from %d, the port of the frontend service", FrontendServicePort)))
+	}
+	if ingress := r.Spec.Ingress; ingress != nil && ingress.TLSSecretName != "" && ingress.Host == "" {
+		errs = append(errs, field.Required(spec.Child("ingress", "host"), "must be set when TLS is enabled"))
+	}
+	if ui := r.Spec.UI; ui != nil && ui.LogoURL != "" {
+		if u, err := url.Parse(ui.LogoURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, field.Invalid(spec.Child("ui", "logoURL"), ui.LogoURL, "must be an absolute http or https URL"))
+		}
+	}
+	if cache := r.Spec.Cache; cache != nil {
+		errs = append(errs, validateResources(spec.Child("cache", "resources"), cache.Resources)...)
+	}
+	if policy := r.Spec.NetworkPolicy; policy != nil {
+		errs = append(errs, validatePeers(spec.Child("networkPolicy", "frontendFrom"), policy.FrontendFrom)...)
+		errs = append(errs, validatePeers(spec.Child("networkPolicy", "metricsFrom"), policy.MetricsFrom)...)
+	}
+	if monitoring := r.Spec.Monitoring; monitoring != nil && monitoring.Alerts != nil {
+		alerts, path := monitoring.Alerts, spec.Child("monitoring", "alerts")
+		if alerts.LatencyThreshold != nil && alerts.LatencyThreshold.Duration <= 0 {
+			errs = append(errs, field.Invalid(path.Child("latencyThreshold"), alerts.LatencyThreshold.Duration.String(), "must be greater than 0"))
+		}
+		if alerts.For != nil && alerts.For.Duration < 0 {
+			errs = append(errs, field.Invalid(path.Child("for"), alerts.For.Duration.String(), "must be greater than or equal to 0"))
+		}
+	}
+	if faults := r.Spec.FaultInjection; faults != nil {
+		errs = append(errs, validateFaultInjection(spec.Child("faultInjection"), faults)...)
+	}
+	if len(r.Spec.Message) > MaxMessageLength {
+		errs = append(errs, field.TooLong(spec.Child("message"), r.Spec.Message, MaxMessageLength))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Podinfo").GroupKind(), r.Name, errs)
+}
+
+// validateComponent checks the overrides of a single tier
+func validateComponent(path *field.Path, component *ComponentSpec) field.ErrorList {
+	var errs field.ErrorList
+	errs = append(errs, validateResources(path.Child("resources"), component.Resources)...)
+	if autoscaling := component.Autoscaling; autoscaling != nil {
+		if autoscaling.MinReplicas != nil && *autoscaling.MinReplicas > autoscaling.MaxReplicas {
+			errs = append(errs, field.Invalid(path.Child("autoscaling", "minReplicas"), *autoscaling.MinReplicas, "must be less than or equal to maxReplicas"))
+		}
+		if rps := autoscaling.TargetHTTPRequestsPerSecond; rps != nil && rps.Sign() <= 0 {
+			errs = append(errs, field.Invalid(path.Child("autoscaling", "targetHTTPRequestsPerSecond"), rps.String(), "must be greater than 0"))
+		}
+	}
+	if pdb := component.PodDisruptionBudget; pdb != nil {
+		errs = append(errs, validatePodDisruptionBudget(path.Child("podDisruptionBudget"), pdb, component.minReplicas())...)
+	}
+	for i, secret := range component.ImagePullSecrets {
+		if secret.Name == "" {
+			errs = append(errs, field.Required(path.Child("imagePullSecrets").Index(i).Child("name"), ""))
+		}
+	}
+	if config := component.Config; config != nil {
+		errs = append(errs, validateConfig(path.Child("config"), config)...)
+	}
+	for i := range component.Patches {
+		if _, _, err := component.Patches[i].Decode(); err != nil {
+			errs = append(errs, field.Invalid(path.Child("patches").Index(i).Child("patch"), component.Patches[i].Patch, err.Error()))
+		}
+	}
+	return errs
+}
+
+// validateConfig checks that the servers of podinfo listen on distinct ports, that the timeouts are positive
+// and that the random delay range isn't empty
+func validateConfig(path *field.Path, config *PodinfoConfig) field.ErrorList {
+	var errs field.ErrorList
+	ports := map[int32]string{config.HTTPPort(): "port"}
+	for _, p := range []struct {
+		name string
+		port int32
+	}{{"metricsPort", config.MetricsServerPort()}, {"grpcPort", config.GRPCServerPort()}} {
+		if other, ok := ports[p.port]; ok {
+			errs = append(errs, field.Invalid(path.Child(p.name), p.port, "must be different from "+other))
+		}
+		ports[p.port] = p.name
+	}
+	for _, t := range []struct {
+		name    string
+		timeout *metav1.Duration
+	}{
+		{"httpServerTimeout", config.HTTPServerTimeout},
+		{"httpServerShutdownTimeout", config.HTTPServerShutdownTimeout},
+		{"httpClientTimeout", config.HTTPClientTimeout},
+	} {
+		if t.timeout != nil && t.timeout.Duration <= 0 {
+			errs = append(errs, field.Invalid(path.Child(t.name), t.timeout.Duration.String(), "must be greater than 0"))
+		}
+	}
+	if delay := config.RandomDelay; delay != nil && delay.Max != nil && *delay.Max < delay.Min {
+		errs = append(errs, field.Invalid(path.Child("randomDelay", "max"), *delay.Max, "must be greater than or equal to min"))
+	}
+	return errs
+}
+
+// validateFaultInjection checks that the fault injection injects at least one fault and that its active windows
+// are either scheduled by a valid cron expression or by a positive interval
+func validateFaultInjection(path *field.Path, faults *FaultInjectionSpec) field.ErrorList {
+	var errs field.ErrorList
+	if faults.RandomDelay == nil && !faults.RandomError && faults.StressCPU == 0 && faults.StressMemory == 0 {
+		errs = append(errs, field.Required(path, "at least one of randomDelay, randomError, stressCPU and stressMemory must be set"))
+	}
+	if delay := faults.RandomDelay; delay != nil && delay.Max != nil && *delay.Max < delay.Min {
+		errs = append(errs, field.Invalid(path.Child("randomDelay", "max"), *delay.Max, "must be greater than or equal to min"))
+	}
+	if faults.Schedule != "" {
+		if _, err := cron.ParseStandard(faults.Schedule); err != nil {
+			errs = append(errs, field.Invalid(path.Child("schedule"), faults.Schedule, err.Error()))
+		}
+		if faults.Interval != nil {
+			errs = append(errs, field.Invalid(path.Child("interval"), faults.Interval.Duration.String(), "can't be combined with the schedule"))
+		}
+	}
+	if interval := faults.Interval; interval != nil && interval.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("interval"), interval.Duration.String(), "must be greater than 0"))
+	}
+	scheduled := faults.Schedule != "" || faults.Interval != nil
+	duration := faults.Duration
+	switch {
+	case duration == nil:
+		if scheduled {
+			errs = append(errs, field.Required(path.Child("duration"), "must be set with the schedule or the interval"))
+		}
+	case !scheduled:
+		errs = append(errs, field.Invalid(path.Child("duration"), duration.Duration.String(), "requires the schedule or the interval"))
+	case duration.Duration <= 0:
+		errs = append(errs, field.Invalid(path.Child("duration"), duration.Duration.String(), "must be greater than 0"))
+	case faults.Interval != nil && duration.Duration > faults.Interval.Duration:
+		errs = append(errs, field.Invalid(path.Child("duration"), duration.Duration.String(), "must be less than or equal to the interval"))
+	}
+	return errs
+}
+
+// validateResources checks that none of the requests exceeds its limit
+func validateResources(path *field.Path, resources *corev1.ResourceRequirements) field.ErrorList {
+	var errs field.ErrorList
+	if resources == nil {
+		return errs
+	}
+	for name, request := range resources.Requests {
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			errs = append(errs, field.Invalid(path.Child("requests").Key(string(name)), request.String(), "must be less than or equal to the limit"))
+		}
+	}
+	return errs
+}
+
+// validatePodDisruptionBudget checks that exactly one of the limits is set and that the budget
+// allows evicting at least one of the pods when the tier runs with the given number of replicas,
+// otherwise the tier's pods would block the drains of their nodes
+func validatePodDisruptionBudget(path *field.Path, pdb *PodDisruptionBudgetSpec, replicas int32) field.ErrorList {
+	var errs field.ErrorList
+	switch {
+	case pdb.MinAvailable == nil && pdb.MaxUnavailable == nil:
+		return append(errs, field.Required(path, "one of minAvailable and maxUnavailable must be set"))
+	case pdb.MinAvailable != nil && pdb.MaxUnavailable != nil:
+		return append(errs, field.Forbidden(path.Child("maxUnavailable"), "may not be set together with minAvailable"))
+	}
+	if replicas <= 0 {
+		return errs
+	}
+	if pdb.MinAvailable != nil {
+		minAvailable, err := intstr.GetScaledValueFromIntOrPercent(pdb.MinAvailable, int(replicas), true)
+		if err != nil {
+			return append(errs, field.Invalid(path.Child("minAvailable"), pdb.MinAvailable.String(), err.Error()))
+		}
+		if minAvailable < 0 {
+			errs = append(errs, field.Invalid(path.Child("minAvailable"), pdb.MinAvailable.String(), "must be greater than or equal to 0"))
+		} else if minAvailable >= int(replicas) {
+			errs = append(errs, field.Invalid(path.Child("minAvailable"), pdb.MinAvailable.String(),
+				fmt.Sprintf("must allow at least one of the %d replicas to be evicted", replicas)))
+		}
+		return errs
+	}
+	maxUnavailable, err := intstr.GetScaledValueFromIntOrPercent(pdb.MaxUnavailable, int(replicas), true)
+	if err != nil {
+		return append(errs, field.Invalid(path.Child("maxUnavailable"), pdb.MaxUnavailable.String(), err.Error()))
+	}
+	if maxUnavailable < 1 {
+		errs = append(errs, field.Invalid(path.Child("maxUnavailable"), pdb.MaxUnavailable.String(),
+			fmt.Sprintf("must allow at least one of the %d replicas to be evicted", replicas)))
+	}
+	return errs
+}
+
+// validatePeers checks that each of the network policy peers selects something
+func validatePeers(path *field.Path, peers []networkingv1.NetworkPolicyPeer) field.ErrorList {
+	var errs field.ErrorList
+	for i, peer := range peers {
+		if peer.PodSelector == nil && peer.NamespaceSelector == nil && peer.IPBlock == nil {
+			errs = append(errs, field.Required(path.Index(i), "one of podSelector, namespaceSelector and ipBlock must be set"))
+		}
+	}
+	return errs
+}
+
+// minReplicas returns the lowest number of replicas the tier can run with
+func (c *ComponentSpec) minReplicas() int32 {
+	if c.Autoscaling == nil {
+		return c.ReplicaCount()
+	}
+	if c.Autoscaling.MinReplicas == nil {
+		return 1
+	}
+	return *c.Autoscaling.MinReplicas
+}
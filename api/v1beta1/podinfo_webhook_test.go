@@ -0,0 +1,270 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+)
+
+var _ = Describe("Podinfo webhook", func() {
+	var podinfo *Podinfo
+
+	BeforeEach(func() {
+		podinfo = &Podinfo{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "podinfo-",
+				Namespace:    "default",
+			},
+		}
+	})
+
+	Context("defaulting", func() {
+		It("fills in the replicas, message and deletion policy", func() {
+			Expect(k8sClient.Create(ctx, podinfo)).To(Succeed())
+
+			Expect(podinfo.Spec.Frontend.Replicas).To(Equal(pointer.Int32Ptr(1)))
+			Expect(podinfo.Spec.Backend.Replicas).To(Equal(pointer.Int32Ptr(1)))
+			Expect(podinfo.Spec.Message).To(Equal(DefaultMessage))
+			Expect(podinfo.Spec.DeletionPolicy).To(Equal(DeletionPolicyDelete))
+		})
+
+		It("keeps the explicit values", func() {
+			podinfo.Spec = PodinfoSpec{
+				Frontend:       ComponentSpec{Replicas: pointer.Int32Ptr(3)},
+				Backend:        ComponentSpec{Replicas: pointer.Int32Ptr(2)},
+				Message:        "Hello Podinfo",
+				DeletionPolicy: DeletionPolicyOrphan,
+			}
+			Expect(k8sClient.Create(ctx, podinfo)).To(Succeed())
+
+			Expect(podinfo.Spec.Frontend.Replicas).To(Equal(pointer.Int32Ptr(3)))
+			Expect(podinfo.Spec.Backend.Replicas).To(Equal(pointer.Int32Ptr(2)))
+			Expect(podinfo.Spec.Message).To(Equal("Hello Podinfo"))
+			Expect(podinfo.Spec.DeletionPolicy).To(Equal(DeletionPolicyOrphan))
+		})
+
+		It("keeps explicit zero replicas", func() {
+			podinfo.Spec.Frontend.Replicas = pointer.Int32Ptr(0)
+			podinfo.Spec.Backend.Replicas = pointer.Int32Ptr(0)
+			Expect(k8sClient.Create(ctx, podinfo)).To(Succeed())
+
+			Expect(podinfo.Spec.Frontend.Replicas).To(Equal(pointer.Int32Ptr(0)))
+			Expect(podinfo.Spec.Backend.Replicas).To(Equal(pointer.Int32Ptr(0)))
+		})
+	})
+
+	Context("validation", func() {
+		expectInvalid := func(field string) {
+			err := k8sClient.Create(ctx, podinfo)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue(), "expected invalid error, got %v", err)
+			Expect(err.Error()).To(ContainSubstring(field))
+		}
+
+		It("rejects negative replicas", func() {
+			podinfo.Spec.Frontend.Replicas = pointer.Int32Ptr(-1)
+			expectInvalid("spec.frontend.replicas")
+
+			podinfo.Spec.Frontend.Replicas = pointer.Int32Ptr(1)
+			podinfo.Spec.Backend.Replicas = pointer.Int32Ptr(-2)
+			expectInvalid("spec.backend.replicas")
+		})
+
+		It("rejects a frontend without a backend", func() {
+			podinfo.Spec.Frontend.Replicas = pointer.Int32Ptr(2)
+			podinfo.Spec.Backend.Replicas = pointer.Int32Ptr(0)
+			expectInvalid("spec.backend.replicas")
+		})
+
+		It("rejects too long messages", func() {
+			podinfo.Spec.Message = strings.Repeat("a", MaxMessageLength+1)
+			expectInvalid("spec.message")
+		})
+
+		It("rejects requests above the limits", func() {
+			podinfo.Spec.Frontend.Resources = &corev1.ResourceRequirements{
+				Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")},
+			}
+			expectInvalid("spec.frontend.resources.requests[cpu]")
+		})
+
+		It("rejects cache requests above the limits", func() {
+			podinfo.Spec.Cache = &CacheSpec{Resources: &corev1.ResourceRequirements{
+				Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+				Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+			}}
+			expectInvalid("spec.cache.resources.requests[memory]")
+		})
+
+		It("rejects image pull secrets without a name", func() {
+			podinfo.Spec.Backend.ImagePullSecrets = []corev1.LocalObjectReference{{}}
+			expectInvalid("spec.backend.imagePullSecrets[0].name")
+		})
+
+		It("rejects TLS without a host", func() {
+			podinfo.Spec.Ingress = &IngressSpec{TLSSecretName: "podinfo-tls"}
+			expectInvalid("spec.ingress.host")
+		})
+
+		It("rejects relative ingress paths", func() {
+			podinfo.Spec.Ingress = &IngressSpec{Path: "podinfo"}
+			expectInvalid("spec.ingress.path")
+		})
+
+		It("rejects autoscaling with minReplicas above maxReplicas", func() {
+			podinfo.Spec.Backend.Autoscaling = &AutoscalingSpec{MinReplicas: pointer.Int32Ptr(3), MaxReplicas: 2}
+			expectInvalid("spec.backend.autoscaling.minReplicas")
+		})
+
+		It("rejects pod disruption budgets that block the drains", func() {
+			all := intstr.FromString("100%")
+			podinfo.Spec.Frontend.Replicas = pointer.Int32Ptr(2)
+			podinfo.Spec.Frontend.PodDisruptionBudget = &PodDisruptionBudgetSpec{MinAvailable: &all}
+			expectInvalid("spec.frontend.podDisruptionBudget.minAvailable")
+
+			none := intstr.FromInt(0)
+			podinfo.Spec.Frontend.PodDisruptionBudget = &PodDisruptionBudgetSpec{MaxUnavailable: &none}
+			expectInvalid("spec.frontend.podDisruptionBudget.maxUnavailable")
+
+			// a single replica can't be evicted with minAvailable 1
+			one := intstr.FromInt(1)
+			podinfo.Spec.Frontend.PodDisruptionBudget = nil
+			podinfo.Spec.Backend.Autoscaling = &AutoscalingSpec{MaxReplicas: 3}
+			podinfo.Spec.Backend.PodDisruptionBudget = &PodDisruptionBudgetSpec{MinAvailable: &one}
+			expectInvalid("spec.backend.podDisruptionBudget.minAvailable")
+		})
+
+		It("rejects pod disruption budgets with none or both of the limits", func() {
+			one := intstr.FromInt(1)
+			podinfo.Spec.Backend.PodDisruptionBudget = &PodDisruptionBudgetSpec{}
+			expectInvalid("spec.backend.podDisruptionBudget")
+
+			podinfo.Spec.Backend.PodDisruptionBudget = &PodDisruptionBudgetSpec{MinAvailable: &one, MaxUnavailable: &one}
+			expectInvalid("spec.backend.podDisruptionBudget.maxUnavailable")
+		})
+
+		It("allows pod disruption budgets that leave a replica to evict", func() {
+			one := intstr.FromInt(1)
+			half := intstr.FromString("50%")
+			podinfo.Spec.Frontend.Replicas = pointer.Int32Ptr(2)
+			podinfo.Spec.Frontend.PodDisruptionBudget = &PodDisruptionBudgetSpec{MinAvailable: &one}
+			podinfo.Spec.Backend.PodDisruptionBudget = &PodDisruptionBudgetSpec{MaxUnavailable: &half}
+			Expect(k8sClient.Create(ctx, podinfo)).To(Succeed())
+		})
+
+		It("rejects network policy peers that select nothing", func() {
+			podinfo.Spec.NetworkPolicy = &NetworkPolicySpec{
+				Enabled:     true,
+				MetricsFrom: []networkingv1.NetworkPolicyPeer{{}},
+			}
+			expectInvalid("spec.networkPolicy.metricsFrom[0]")
+		})
+
+		It("rejects a non-positive latency threshold", func() {
+			podinfo.Spec.Monitoring = &MonitoringSpec{Alerts: &AlertsSpec{LatencyThreshold: &metav1.Duration{}}}
+			expectInvalid("spec.monitoring.alerts.latencyThreshold")
+		})
+
+		It("rejects patches that are neither strategic merge nor JSON patches", func() {
+			podinfo.Spec.Frontend.Patches = []Patch{{Target: PatchTargetDeployment, Patch: "spec: {}"}, {Target: PatchTargetService, Patch: "just text"}}
+			expectInvalid("spec.frontend.patches[1].patch")
+
+			podinfo.Spec.Frontend.Patches = []Patch{{Target: PatchTargetDeployment, Patch: `[{"op": "copy", "path": "/spec"}]`}}
+			expectInvalid("spec.frontend.patches[0].patch")
+		})
+
+		It("rejects logo URLs that aren't absolute http(s) URLs", func() {
+			podinfo.Spec.UI = &UISpec{LogoURL: "/logo.png"}
+			expectInvalid("spec.ui.logoURL")
+
+			podinfo.Spec.UI = &UISpec{LogoURL: "ftp://example.com/logo.png"}
+			expectInvalid("spec.ui.logoURL")
+		})
+
+		It("rejects conflicting ports, empty random delay ranges and non-positive timeouts", func() {
+			podinfo.Spec.Backend.Config = &PodinfoConfig{MetricsPort: pointer.Int32Ptr(DefaultPort)}
+			expectInvalid("spec.backend.config.metricsPort")
+
+			podinfo.Spec.Backend.Config = &PodinfoConfig{Port: pointer.Int32Ptr(8080), GRPCPort: pointer.Int32Ptr(8080)}
+			expectInvalid("spec.backend.config.grpcPort")
+
+			podinfo.Spec.Backend.Config = nil
+			podinfo.Spec.Frontend.Config = &PodinfoConfig{MetricsPort: pointer.Int32Ptr(FrontendServicePort)}
+			expectInvalid("spec.frontend.config.metricsPort")
+
+			podinfo.Spec.Frontend.Config = &PodinfoConfig{RandomDelay: &RandomDelaySpec{Min: 5, Max: pointer.Int32Ptr(1)}}
+			expectInvalid("spec.frontend.config.randomDelay.max")
+
+			podinfo.Spec.Frontend.Config = &PodinfoConfig{HTTPClientTimeout: &metav1.Duration{}}
+			expectInvalid("spec.frontend.config.httpClientTimeout")
+		})
+
+		It("rejects fault injection without faults or with invalid windows", func() {
+			minutes := func(m int) *metav1.Duration {
+				return &metav1.Duration{Duration: time.Duration(m) * time.Minute}
+			}
+			podinfo.Spec.FaultInjection = &FaultInjectionSpec{}
+			expectInvalid("spec.faultInjection: Required value")
+
+			podinfo.Spec.FaultInjection = &FaultInjectionSpec{RandomError: true, Schedule: "every hour", Duration: minutes(5)}
+			expectInvalid("spec.faultInjection.schedule")
+
+			podinfo.Spec.FaultInjection = &FaultInjectionSpec{RandomError: true, Schedule: "0 * * * *", Interval: minutes(60), Duration: minutes(5)}
+			expectInvalid("spec.faultInjection.interval")
+
+			podinfo.Spec.FaultInjection = &FaultInjectionSpec{RandomError: true, Schedule: "0 * * * *"}
+			expectInvalid("spec.faultInjection.duration")
+
+			podinfo.Spec.FaultInjection = &FaultInjectionSpec{RandomError: true, Interval: minutes(10), Duration: minutes(20)}
+			expectInvalid("spec.faultInjection.duration")
+
+			podinfo.Spec.FaultInjection = &FaultInjectionSpec{StressCPU: 1, Duration: minutes(20)}
+			expectInvalid("spec.faultInjection.duration")
+		})
+
+		It("allows an autoscaled backend without replicas", func() {
+			podinfo.Spec.Frontend.Replicas = pointer.Int32Ptr(2)
+			podinfo.Spec.Backend.Replicas = pointer.Int32Ptr(0)
+			podinfo.Spec.Backend.Autoscaling = &AutoscalingSpec{MaxReplicas: 3}
+			Expect(k8sClient.Create(ctx, podinfo)).To(Succeed())
+		})
+
+		It("validates updates", func() {
+			Expect(k8sClient.Create(ctx, podinfo)).To(Succeed())
+			podinfo.Spec.Backend.Replicas = pointer.Int32Ptr(-1)
+			err := k8sClient.Update(ctx, podinfo)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+
+		It("allows to scale both tiers down to zero", func() {
+			podinfo.Spec.Frontend.Replicas = pointer.Int32Ptr(0)
+			podinfo.Spec.Backend.Replicas = pointer.Int32Ptr(0)
+			Expect(k8sClient.Create(ctx, podinfo)).To(Succeed())
+		})
+	})
+})
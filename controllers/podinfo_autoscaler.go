@@ -0,0 +1,95 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+	"github.com/jkremser/podinfo-operator/controllers/utils"
+)
+
+// replicasHandOverManager co-owns the replicas of a deployment that becomes autoscaled, so that they
+// aren't reset to the default when the operator stops applying them
+const replicasHandOverManager = FieldManager + "-handover"
+
+// ReconcileAutoscaler creates or updates the horizontal pod autoscaler of an autoscaled tier, and
+// removes the autoscaler created earlier when the autoscaling of the tier is dropped
+func (r *PodinfoReconciler) ReconcileAutoscaler(ctx context.Context, podinfo *v1beta1.Podinfo, backend bool, log logr.Logger) error {
+	imgSuffix := "-fe"
+	if backend {
+		imgSuffix = "-be"
+	}
+	key := client.ObjectKey{Name: podinfo.Name + imgSuffix, Namespace: podinfo.Namespace}
+	var desired client.Object
+	if utils.Component(podinfo, backend).Autoscaling != nil {
+		desired = utils.PodinfoAutoscaler(podinfo, backend)
+	}
+	return r.applyOptional(ctx, podinfo, "HorizontalPodAutoscaler", key, &autoscalingv2beta2.HorizontalPodAutoscaler{}, desired, log)
+}
+
+// releaseReplicas hands the replicas of a deployment that becomes autoscaled over to another field manager.
+// Server-side apply removes the fields the applier stops setting, so without the hand over the deployment
+// would be scaled to the default of 1 replica before the autoscaler scales it again.
+func (r *PodinfoReconciler) releaseReplicas(ctx context.Context, deployment *appsv1.Deployment) error {
+	if deployment.Spec.Replicas == nil || !managesField(deployment, FieldManager, "f:spec", "f:replicas") {
+		return nil
+	}
+	handOver := &unstructured.Unstructured{}
+	handOver.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	handOver.SetName(deployment.Name)
+	handOver.SetNamespace(deployment.Namespace)
+	if err := unstructured.SetNestedField(handOver.Object, int64(*deployment.Spec.Replicas), "spec", "replicas"); err != nil {
+		return err
+	}
+	return r.Patch(ctx, handOver, client.Apply, client.FieldOwner(replicasHandOverManager))
+}
+
+// managesField returns true if the field manager owns the field by applying it, the path is in the format
+// of the managed fields, e.g. "f:spec", "f:replicas"
+func managesField(obj metav1.Object, manager string, path ...string) bool {
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager != manager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		found := true
+		for _, p := range path {
+			next, ok := fields[p].(map[string]interface{})
+			if !ok {
+				found = false
+				break
+			}
+			fields = next
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
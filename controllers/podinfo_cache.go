@@ -0,0 +1,52 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+	"github.com/jkremser/podinfo-operator/controllers/utils"
+)
+
+// ReconcileCache creates or updates the deployment, the service and (with the network policies enabled) the
+// network policy of the Redis cache tier, and removes them when the cache is dropped from the podinfo spec
+func (r *PodinfoReconciler) ReconcileCache(ctx context.Context, podinfo *v1beta1.Podinfo, log logr.Logger) error {
+	log = log.WithValues("tier", "cache")
+	key := client.ObjectKey{Name: podinfo.Name + "-cache", Namespace: podinfo.Namespace}
+	var deployment, service, policy client.Object
+	if podinfo.Spec.Cache != nil {
+		deployment = utils.PodinfoCacheDeployment(podinfo)
+		service = utils.PodinfoCacheService(podinfo)
+		if podinfo.Spec.NetworkPolicy != nil && podinfo.Spec.NetworkPolicy.Enabled {
+			policy = utils.PodinfoCacheNetworkPolicy(podinfo)
+		}
+	}
+	if err := r.applyOptional(ctx, podinfo, "Deployment", key, &appsv1.Deployment{}, deployment, log); err != nil {
+		return err
+	}
+	if err := r.applyOptional(ctx, podinfo, "Service", key, &corev1.Service{}, service, log); err != nil {
+		return err
+	}
+	return r.applyOptional(ctx, podinfo, "NetworkPolicy", key, &networkingv1.NetworkPolicy{}, policy, log)
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+	"github.com/jkremser/podinfo-operator/controllers/utils"
+)
+
+// Finalize cleans up the objects generated for the podinfo according to its deletion policy and removes
+// the finalizer. The cleanup is idempotent, objects that are already gone are skipped and a failure on
+// one object doesn't prevent the others from being cleaned up.
+func (r *PodinfoReconciler) Finalize(ctx context.Context, podinfo *v1beta1.Podinfo, log logr.Logger) error {
+	if !controllerutil.ContainsFinalizer(podinfo, v1beta1.Finalizer) {
+		return nil
+	}
+	policy := podinfo.Spec.DeletionPolicy
+	if policy == "" {
+		policy = v1beta1.DeletionPolicyDelete
+	}
+
+	var errs []error
+	for _, suffix := range []string{"-fe", "-be", "-cache"} {
+		key := client.ObjectKey{Name: podinfo.Name + suffix, Namespace: podinfo.Namespace}
+		objs := []client.Object{&appsv1.Deployment{}, &corev1.Service{}, &networkingv1.NetworkPolicy{}}
+		if suffix != "-cache" {
+			objs = append(objs, &autoscalingv2beta2.HorizontalPodAutoscaler{}, &policyv1beta1.PodDisruptionBudget{})
+		}
+		if suffix == "-fe" {
+			objs = append(objs, &networkingv1.Ingress{})
+		}
+		for _, obj := range objs {
+			err := r.cleanup(ctx, podinfo, key, obj, policy)
+			if ctx.Err() != nil {
+				// the remaining objects are cleaned up by the next attempt
+				return ctx.Err()
+			}
+			if err != nil {
+				log.Error(err, "Unable to clean up", "name", key.Name, "namespace", key.Namespace, "policy", policy)
+				errs = append(errs, err)
+			}
+		}
+	}
+	// the service monitor and the prometheus rule are named after the podinfo
+	key := client.ObjectKey{Name: podinfo.Name, Namespace: podinfo.Namespace}
+	for _, gvk := range []schema.GroupVersionKind{utils.ServiceMonitorGVK, utils.PrometheusRuleGVK} {
+		available, err := r.kindAvailable(gvk)
+		if err == nil && available {
+			obj := &unstructured.Unstructured{}
+			obj.SetGroupVersionKind(gvk)
+			err = r.cleanup(ctx, podinfo, key, obj, policy)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Error(err, "Unable to clean up", "kind", gvk.Kind, "name", key.Name, "namespace", key.Namespace, "policy", policy)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		err := utilerrors.NewAggregate(errs)
+		r.Recorder.Event(podinfo, corev1.EventTypeWarning, ReasonCleanupFailed, err.Error())
+		return err
+	}
+
+	log.Info("podinfo was cleaned up", "policy", policy)
+	r.Recorder.Eventf(podinfo, corev1.EventTypeNormal, ReasonCleanedUp, "Cleaned up the generated objects with the %s policy", policy)
+	controllerutil.RemoveFinalizer(podinfo, v1beta1.Finalizer)
+	return r.Update(ctx, podinfo)
+}
+
+// cleanup deletes or orphans a single object, objects not controlled by the podinfo are left alone
+func (r *PodinfoReconciler) cleanup(ctx context.Context, podinfo *v1beta1.Podinfo, key client.ObjectKey, obj client.Object, policy v1beta1.DeletionPolicy) error {
+	err := r.Get(ctx, key, obj)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if owner := metav1.GetControllerOf(obj); owner == nil || owner.UID != podinfo.UID {
+		return nil
+	}
+
+	if policy == v1beta1.DeletionPolicyOrphan {
+		original := obj.DeepCopyObject().(client.Object)
+		var refs []metav1.OwnerReference
+		for _, ref := range obj.GetOwnerReferences() {
+			if ref.UID != podinfo.UID {
+				refs = append(refs, ref)
+			}
+		}
+		obj.SetOwnerReferences(refs)
+		return client.IgnoreNotFound(r.Patch(ctx, obj, client.MergeFrom(original)))
+	}
+
+	err = r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
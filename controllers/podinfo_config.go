@@ -0,0 +1,189 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+	"github.com/jkremser/podinfo-operator/controllers/utils"
+)
+
+// ConfigHashAnnotation is put on the pod template of a tier whose environment refers to ConfigMaps or Secrets,
+// it carries the hash of their content so that the tier is rolled out when they change
+const ConfigHashAnnotation = "info.podinfo-operator.io/config-hash"
+
+// configReference is a ConfigMap or a Secret the environment of a tier refers to
+type configReference struct {
+	secret bool
+	name   string
+}
+
+// configReferences returns the ConfigMaps and Secrets the environment of the tier refers to, sorted and
+// without duplicates
+func configReferences(component *v1beta1.ComponentSpec) []configReference {
+	seen := map[configReference]bool{}
+	for _, env := range component.Env {
+		if from := env.ValueFrom; from != nil {
+			if from.ConfigMapKeyRef != nil {
+				seen[configReference{name: from.ConfigMapKeyRef.Name}] = true
+			}
+			if from.SecretKeyRef != nil {
+				seen[configReference{secret: true, name: from.SecretKeyRef.Name}] = true
+			}
+		}
+	}
+	for _, envFrom := range component.EnvFrom {
+		if envFrom.ConfigMapRef != nil {
+			seen[configReference{name: envFrom.ConfigMapRef.Name}] = true
+		}
+		if envFrom.SecretRef != nil {
+			seen[configReference{secret: true, name: envFrom.SecretRef.Name}] = true
+		}
+	}
+	refs := make([]configReference, 0, len(seen))
+	for ref := range seen {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].secret != refs[j].secret {
+			return !refs[i].secret
+		}
+		return refs[i].name < refs[j].name
+	})
+	return refs
+}
+
+// key returns the value of the configReferencesField index the podinfoes referring to the object are found by
+func (ref configReference) key() string {
+	if ref.secret {
+		return "Secret/" + ref.name
+	}
+	return "ConfigMap/" + ref.name
+}
+
+// configHash returns the hash of the content of the ConfigMaps and Secrets the environment of the tier
+// refers to, or empty string if it doesn't refer to any. The missing ones (e.g. optional) are skipped.
+// The objects are read from the API server, only their metadata is cached.
+func (r *PodinfoReconciler) configHash(ctx context.Context, podinfo *v1beta1.Podinfo, backend bool) (string, error) {
+	refs := configReferences(utils.Component(podinfo, backend))
+	if len(refs) == 0 {
+		return "", nil
+	}
+	reader := r.apiReader()
+	hash := sha256.New()
+	for _, ref := range refs {
+		key := client.ObjectKey{Name: ref.name, Namespace: podinfo.Namespace}
+		var data map[string][]byte
+		if ref.secret {
+			secret := &corev1.Secret{}
+			err := reader.Get(ctx, key, secret)
+			if errors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			data = secret.Data
+		} else {
+			configMap := &corev1.ConfigMap{}
+			err := reader.Get(ctx, key, configMap)
+			if errors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			data = map[string][]byte{}
+			for k, v := range configMap.Data {
+				data[k] = []byte(v)
+			}
+			for k, v := range configMap.BinaryData {
+				data[k] = v
+			}
+		}
+		kind := "ConfigMap"
+		if ref.secret {
+			kind = "Secret"
+		}
+		hashEntry(hash, kind, ref.name)
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			hashEntry(hash, k, string(data[k]))
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16], nil
+}
+
+// hashEntry writes the length prefixed values into the hash, so that different entries can't collide
+func hashEntry(hash io.Writer, values ...string) {
+	for _, value := range values {
+		fmt.Fprintf(hash, "%d:%s", len(value), value)
+	}
+}
+
+// configReferencesField indexes the podinfoes by the ConfigMaps and Secrets their environment refers to
+const configReferencesField = ".spec.configReferences"
+
+// indexConfigReferences returns the configReferencesField index values of the podinfo
+func indexConfigReferences(obj client.Object) []string {
+	podinfo, ok := obj.(*v1beta1.Podinfo)
+	if !ok {
+		return nil
+	}
+	var keys []string
+	for _, backend := range []bool{false, true} {
+		for _, ref := range configReferences(utils.Component(podinfo, backend)) {
+			keys = append(keys, ref.key())
+		}
+	}
+	return keys
+}
+
+// podinfoesReferring returns the function mapping a ConfigMap (or a Secret) to the podinfoes in its namespace
+// whose environment refers to it, the podinfoes are looked up by the configReferencesField index
+func (r *PodinfoReconciler) podinfoesReferring(ctx context.Context, secret bool) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		ref := configReference{secret: secret, name: obj.GetName()}
+		podinfoes := &v1beta1.PodinfoList{}
+		err := r.List(ctx, podinfoes, client.InNamespace(obj.GetNamespace()), client.MatchingFields{configReferencesField: ref.key()})
+		if err != nil {
+			r.Log.Error(err, "Unable to list the podinfoes referring to", "object", ref.key(), "namespace", obj.GetNamespace())
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(podinfoes.Items))
+		for i := range podinfoes.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&podinfoes.Items[i])})
+		}
+		return requests
+	}
+}
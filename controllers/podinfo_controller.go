@@ -18,26 +18,60 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/jkremser/podinfo-operator/controllers/utils"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	v1alpha1 "github.com/jkremser/podinfo-operator/api/v1alpha1"
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
 )
 
+// FieldManager is the name of the field manager the operator uses for server-side apply
+const FieldManager = "podinfo-operator"
+
 // PodinfoReconciler reconciles a Podinfo object
 type PodinfoReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Log is used outside of the reconciliations (e.g. when mapping the watched objects to podinfoes), the
+	// reconciliations log with the logger of their context
+	Log logr.Logger
+	// APIReader reads the ConfigMaps and Secrets referenced by the podinfoes, only their metadata is cached.
+	// The client is used if nil.
+	APIReader client.Reader
+	// DefaultVersion is the podinfo version deployed for the podinfoes that don't specify any,
+	// utils.PodinfoVersion is used if empty
+	DefaultVersion string
+	// ReconcileTimeout bounds a single reconciliation including all its API calls, the reconciliation
+	// is requeued when it runs out of time. Zero means no timeout.
+	ReconcileTimeout time.Duration
+	// ResyncInterval is the interval of re-examining the podinfoes that are ready, zero turns the resync off.
+	// Podinfoes that aren't ready are re-examined with a backoff regardless.
+	ResyncInterval time.Duration
+	// Templates the deployments and services are rendered from, utils.DefaultTemplates are used if nil
+	Templates *utils.Templates
 }
 
 //+kubebuilder:rbac:groups=info.podinfo-operator.io,resources=podinfoes,verbs=get;list;watch;create;update;patch;delete
@@ -45,7 +79,14 @@ type PodinfoReconciler struct {
 //+kubebuilder:rbac:groups=info.podinfo-operator.io,resources=podinfoes/finalizers,verbs=update
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=deployments,verbs=get;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups="",resources=services,verbs=get;watch;list;create;delete
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=configmaps;secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors;prometheusrules,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -57,139 +98,422 @@ type PodinfoReconciler struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
 func (r *PodinfoReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
-	log := ctrl.Log.WithName("podinfo_controller")
+	// the logger of the request carries the name and the namespace of the podinfo
+	log := log.FromContext(ctx).WithValues("reconcileID", uuid.NewUUID())
+	log.V(1).Info("Reconciling podinfo")
+	if r.ReconcileTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.ReconcileTimeout)
+		defer cancel()
+	}
 
 	// get podinfo that triggered the event
-	podinfo := &v1alpha1.Podinfo{}
-	err := r.Client.Get(context.TODO(), req.NamespacedName, podinfo)
+	podinfo := &v1beta1.Podinfo{}
+	err := r.Client.Get(ctx, req.NamespacedName, podinfo)
 
 	if err != nil {
 		if errors.IsNotFound(err) {
-			log.Info("podinfo was deleted", "name", req.NamespacedName.Name, "namespace", req.NamespacedName.Namespace)
-			err = r.DeleteAll(req.NamespacedName, log)
-			return ctrl.Result{}, err
+			// the cleanup has already been done by the finalizer
+			log.V(1).Info("podinfo is gone")
+			forgetInstance(req.NamespacedName)
+			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request -> can loop
+		log.Error(err, "Unable to get podinfo")
+		observeReconcile(OutcomeGetFailed, err)
 		return ctrl.Result{}, err
 	}
 
+	if !podinfo.DeletionTimestamp.IsZero() {
+		log.Info("podinfo was deleted")
+		err = r.Finalize(ctx, podinfo, log)
+		if err != nil {
+			observeReconcile(OutcomeFinalizeFailed, err)
+			return ctrl.Result{}, err
+		}
+		observeReconcile(OutcomeFinalized, nil)
+		forgetInstance(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+	if !controllerutil.ContainsFinalizer(podinfo, v1beta1.Finalizer) {
+		controllerutil.AddFinalizer(podinfo, v1beta1.Finalizer)
+		if err = r.Update(ctx, podinfo); err != nil {
+			log.Error(err, "Unable to add the finalizer to podinfo")
+			observeReconcile(OutcomeFinalizerFailed, err)
+			return ctrl.Result{}, err
+		}
+	}
+
+	// turn the fault injection on or off according to its schedule
+	err = r.ReconcileFaultInjection(ctx, podinfo, time.Now(), log)
+	if err != nil {
+		log.Error(err, "Unable to schedule the fault injection of podinfo")
+		return r.reportFailure(ctx, podinfo, OutcomeFaultInjectionFailed, err, log)
+	}
+
+	// create, update or remove the cache of the backend
+	err = r.ReconcileCache(ctx, podinfo, log)
+	if err != nil {
+		log.Error(err, "Unable to deploy cache for podinfo")
+		return r.reportFailure(ctx, podinfo, OutcomeCacheFailed, err, log)
+	}
+
 	// create deployment and service for backend
-	err = r.CreateIfNotExist(podinfo, true, log)
+	err = r.CreateIfNotExist(ctx, podinfo, true, log)
 	if err != nil {
 		log.Error(err, "Unable to deploy backend for podinfo")
-		return ctrl.Result{}, err
+		return r.reportFailure(ctx, podinfo, OutcomeBackendFailed, err, log)
 	}
 
 	// create deployment and service for frontend
-	err = r.CreateIfNotExist(podinfo, false, log)
+	err = r.CreateIfNotExist(ctx, podinfo, false, log)
 	if err != nil {
 		log.Error(err, "Unable to deploy frontend for podinfo")
+		return r.reportFailure(ctx, podinfo, OutcomeFrontendFailed, err, log)
+	}
+
+	// create, update or remove the ingress of the frontend
+	err = r.ReconcileIngress(ctx, podinfo, log)
+	if err != nil {
+		log.Error(err, "Unable to expose the frontend of podinfo")
+		return r.reportFailure(ctx, podinfo, OutcomeIngressFailed, err, log)
+	}
+
+	// create, update or remove the service monitor and the alerting rules
+	err = r.ReconcileMonitoring(ctx, podinfo, log)
+	if err != nil {
+		log.Error(err, "Unable to set up the monitoring of podinfo")
+		return r.reportFailure(ctx, podinfo, OutcomeMonitoringFailed, err, log)
+	}
+
+	err = r.UpdateStatus(ctx, podinfo, nil)
+	if err != nil {
+		log.Error(err, "Unable to update the status of podinfo")
+		observeReconcile(OutcomeStatusUpdateFailed, err)
 		return ctrl.Result{}, err
 	}
-	// Don't requeue
-	return ctrl.Result{}, nil
+	observeReconcile(OutcomeReconciled, nil)
+	result := r.requeue(podinfo, time.Now())
+	log.V(1).Info("podinfo was reconciled", "requeueAfter", result.RequeueAfter)
+	return result, nil
 }
 
-func (r *PodinfoReconciler) CreateIfNotExist(podinfo *v1alpha1.Podinfo, backend bool, log logr.Logger) error {
-	imgSuffix := "-fe"
-	if backend {
-		imgSuffix = "-be"
+// reportFailure records the failed reconciliation in the status of podinfo and in the metrics under the given
+// reason, interrupted reconciliations are only recorded in the metrics. Transient errors are returned so that
+// the podinfo is retried with a backoff, the podinfoes failing with a permanent error aren't retried until
+// they change.
+func (r *PodinfoReconciler) reportFailure(ctx context.Context, podinfo *v1beta1.Podinfo, reason string, reconcileErr error, log logr.Logger) (ctrl.Result, error) {
+	observeReconcile(reason, reconcileErr)
+	if ctx.Err() != nil {
+		// the reconciliation timed out or the operator is shutting down, the status can't be updated
+		// with the same context and the podinfo itself is fine, it's requeued
+		return ctrl.Result{}, reconcileErr
+	}
+	r.Recorder.Event(podinfo, corev1.EventTypeWarning, ReasonReconcileFailed, reconcileErr.Error())
+	if err := r.UpdateStatus(ctx, podinfo, reconcileErr); err != nil {
+		// retried until the failure is surfaced in the status
+		log.Error(err, "Unable to update the status of podinfo")
+		return ctrl.Result{}, reconcileErr
 	}
+	if isPermanent(reconcileErr) {
+		log.Info("Not retrying until the podinfo changes", "error", reconcileErr.Error())
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, reconcileErr
+}
 
+// CreateIfNotExist creates or updates the deployment and the service of the given tier using server-side apply,
+// so that the fields set by other actors (e.g. annotations, injected sidecars) are preserved
+func (r *PodinfoReconciler) CreateIfNotExist(ctx context.Context, podinfo *v1beta1.Podinfo, backend bool, log logr.Logger) error {
+	log = log.WithValues("tier", tierName(backend))
 	// deployment
-	deploymentFound := &appsv1.Deployment{}
-	err := r.Get(context.TODO(), types.NamespacedName{
-		Name:      podinfo.Name + imgSuffix,
-		Namespace: podinfo.Namespace,
-	}, deploymentFound)
-
-	if err != nil && errors.IsNotFound(err) {
-		// let's create a new one <this uses yaml as a template, but failed during the client.create>
-		// frontendDeployment, e := utils.GetDeployment(podInfo.Name+imgSuffix, "podinfo-operator-system", int32(podInfo.Spec.FrontendReplicas), podInfo.Spec.Message)
-
-		if backend {
-			log.Info("podinfo was created", "name", podinfo.Name, "namespace", podinfo.Namespace)
+	version := r.version(podinfo)
+	// the faults are passed to podinfo as flags while the fault injection is active
+	deployment, err := r.templates().PodinfoDeployment(withFaults(podinfo, backend), backend, version)
+	if err != nil {
+		log.Error(err, "Failed to render the Deployment")
+		return permanent(err)
+	}
+	hash, err := r.configHash(ctx, podinfo, backend)
+	if err != nil {
+		log.Error(err, "Failed to read the ConfigMaps and Secrets of the environment")
+		return err
+	}
+	if hash != "" {
+		if deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = map[string]string{}
 		}
-		deployment := utils.PodinfoDeployment(podinfo, backend)
-		// fmt.Printf("%+v\n", deployment)
-
-		e := r.Create(context.TODO(), deployment)
-		if e != nil {
-			log.Error(err, "Failed to create new Deployment", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+		deployment.Spec.Template.Annotations[ConfigHashAnnotation] = hash
+	}
+	deploymentFound := &appsv1.Deployment{}
+	existed, err := r.getOwned(ctx, podinfo, client.ObjectKeyFromObject(deployment), deploymentFound)
+	if err != nil {
+		log.Error(err, "Failed to get the Deployment", "Deployment.Name", deployment.Name)
+		return err
+	}
+	hold := false
+	if existed && !backend && deploymentFound.Spec.Template.Labels[utils.VersionLabel] != version {
+		// the frontend is upgraded only once the backend runs the new version
+		hold, err = r.backendUnavailable(ctx, podinfo, version)
+		if err != nil {
+			log.Error(err, "Failed to get the backend Deployment")
 			return err
 		}
-	} else if err == nil { // change in podinfo custom resource
-		if backend {
-			log.Info("podinfo was changed", "name", podinfo.Name, "namespace", podinfo.Namespace)
+	}
+	if existed && utils.Component(podinfo, backend).Autoscaling != nil {
+		err = r.releaseReplicas(ctx, deploymentFound)
+		if err != nil {
+			log.Error(err, "Failed to hand the replicas over to the autoscaler", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+			return err
 		}
-		deployment := utils.PodinfoDeployment(podinfo, backend)
-		err = r.Update(context.TODO(), deployment)
+	}
+	if hold {
+		log.Info("Holding the frontend upgrade until the backend is available", "version", version)
+		r.Recorder.Eventf(podinfo, corev1.EventTypeNormal, ReasonUpgradeHeld,
+			"Holding the frontend upgrade to %s until the backend is available", version)
+	} else {
+		err = r.apply(ctx, deployment)
 		if err != nil {
-			log.Error(err, "Failed to update the deployment", "deyployment", deployment)
+			log.Error(err, "Failed to apply the Deployment", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+			return err
+		}
+		r.recordApplied(podinfo, "Deployment", existed, deploymentFound, deployment)
+		if !existed {
+			log.Info("Deployment was created", "Deployment.Name", deployment.Name)
+		} else if changed(deploymentFound, deployment) {
+			log.Info("Deployment was changed", "Deployment.Name", deployment.Name)
+		} else {
+			log.V(1).Info("Deployment is up to date", "Deployment.Name", deployment.Name)
 		}
-	} else if err != nil {
-		log.Error(err, "Failed to get Deployment")
-		return err
 	}
 
 	// service
+	svc, err := r.templates().PodinfoService(podinfo, backend)
+	if err != nil {
+		log.Error(err, "Failed to render the Service")
+		return permanent(err)
+	}
 	svcFound := &corev1.Service{}
-	err = r.Get(context.TODO(), types.NamespacedName{
-		Name:      podinfo.Name + imgSuffix,
-		Namespace: podinfo.Namespace,
-	}, svcFound)
-
-	if err != nil && errors.IsNotFound(err) {
-		svc := utils.PodinfoService(podinfo, backend)
-		// fmt.Printf("%+v\n", svc)
-
-		e := r.Create(context.TODO(), svc)
-		if e != nil {
-			log.Error(err, "Failed to create new Service", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+	existed, err = r.getOwned(ctx, podinfo, client.ObjectKeyFromObject(svc), svcFound)
+	if err != nil {
+		log.Error(err, "Failed to get the Service", "Service.Name", svc.Name)
+		return err
+	}
+	var drifted []string
+	if existed {
+		drifted = ServiceDrift(svcFound, svc)
+	}
+	if len(drifted) > 0 {
+		// ports edited or added by someone else are not owned by the operator and would survive the apply,
+		// the port layout of the service is authoritative so replace it
+		CorrectService(svcFound, svc)
+		err = r.Update(ctx, svcFound, client.FieldOwner(FieldManager))
+		if err != nil {
+			log.Error(err, "Failed to update the Service", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
 			return err
 		}
-		return nil
+	}
+	err = r.apply(ctx, svc)
+	if err != nil {
+		log.Error(err, "Failed to apply the Service", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+		return err
+	}
+	if len(drifted) > 0 {
+		log.Info("Service has drifted from the desired state, corrected it", "Service.Name", svc.Name, "fields", drifted)
+		observeDriftCorrection("Service")
+		r.Recorder.Eventf(podinfo, corev1.EventTypeNormal, ReasonDriftCorrected,
+			"Service %s was corrected, drifted fields: %s", svc.Name, strings.Join(drifted, ", "))
+	} else {
+		r.recordApplied(podinfo, "Service", existed, svcFound, svc)
+	}
 
-	} else if err == nil {
-		log.Info("Service is already there, no need to change it")
-	} else if err != nil {
-		log.Error(err, "Failed to get Service")
+	// horizontal pod autoscaler
+	if err := r.ReconcileAutoscaler(ctx, podinfo, backend, log); err != nil {
 		return err
 	}
-	return nil
+
+	// pod disruption budget
+	if err := r.ReconcilePodDisruptionBudget(ctx, podinfo, backend, log); err != nil {
+		return err
+	}
+
+	// network policy
+	return r.ReconcileNetworkPolicy(ctx, podinfo, backend, log)
 }
 
-func (r *PodinfoReconciler) DeleteAll(nn types.NamespacedName, log logr.Logger) error {
-	for _, suffix := range [2]string{"-fe", "-be"} {
-		commonMeta := metav1.ObjectMeta{
-			Name:      nn.Name + suffix,
-			Namespace: nn.Namespace,
-		}
-		err := r.Delete(context.TODO(), &corev1.Service{
-			ObjectMeta: commonMeta,
-		})
-		if err != nil {
-			log.Error(err, "Unable to delete service", "service.name", nn.Name)
-			return err
-		}
+// tierName returns the name of the tier used in the logs and the metrics
+func tierName(backend bool) string {
+	if backend {
+		return "backend"
+	}
+	return "frontend"
+}
+
+// apiReader returns the reader the ConfigMaps and Secrets are read with, the cache holds only their metadata.
+// Without an APIReader the client is used.
+func (r *PodinfoReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// templates returns the templates the deployments and services are rendered from
+func (r *PodinfoReconciler) templates() *utils.Templates {
+	if r.Templates != nil {
+		return r.Templates
+	}
+	return utils.DefaultTemplates()
+}
+
+// version returns the podinfo version the podinfo should run
+func (r *PodinfoReconciler) version(podinfo *v1beta1.Podinfo) string {
+	if podinfo.Spec.Version != "" {
+		return podinfo.Spec.Version
+	}
+	if r.DefaultVersion != "" {
+		return r.DefaultVersion
+	}
+	return utils.PodinfoVersion
+}
+
+// backendUnavailable returns true until all the replicas of the backend are updated to the given version
+// and available
+func (r *PodinfoReconciler) backendUnavailable(ctx context.Context, podinfo *v1beta1.Podinfo, version string) (bool, error) {
+	backend := &appsv1.Deployment{}
+	err := r.Get(ctx, client.ObjectKey{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, backend)
+	if err != nil {
+		return true, client.IgnoreNotFound(err)
+	}
+	return backend.Spec.Template.Labels[utils.VersionLabel] != version || rollingOut(backend) ||
+		backend.Status.AvailableReplicas < desiredReplicas(backend), nil
+}
+
+// getOwned reads the object into obj and checks it isn't controlled by anything else than the podinfo,
+// the returned bool says if the object exists
+func (r *PodinfoReconciler) getOwned(ctx context.Context, podinfo *v1beta1.Podinfo, key client.ObjectKey, obj client.Object) (bool, error) {
+	err := r.Get(ctx, key, obj)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, checkOwnership(obj, podinfo)
+}
 
-		err = r.Delete(context.TODO(), &appsv1.Deployment{
-			ObjectMeta: commonMeta,
-		})
+// applyOptional applies the desired object of an optional feature, or removes the object created earlier
+// when the feature is turned off (desired is nil). found is an empty object of the kind to read the
+// existing object into.
+func (r *PodinfoReconciler) applyOptional(ctx context.Context, podinfo *v1beta1.Podinfo, kind string, key client.ObjectKey, found, desired client.Object, log logr.Logger) error {
+	if desired == nil {
+		deleted, err := r.deleteOwned(ctx, podinfo, key, found)
 		if err != nil {
-			log.Error(err, "Unable to delete deployment", "deployment.name", nn.Name)
+			log.Error(err, "Failed to delete the "+kind, kind+".Namespace", key.Namespace, kind+".Name", key.Name)
 			return err
 		}
+		if deleted {
+			log.Info(kind+" was removed", kind+".Namespace", key.Namespace, kind+".Name", key.Name)
+			r.Recorder.Eventf(podinfo, corev1.EventTypeNormal, ReasonDeleted, "Deleted %s %s", kind, key.Name)
+		}
+		return nil
+	}
+
+	existed, err := r.getOwned(ctx, podinfo, key, found)
+	if err != nil {
+		log.Error(err, "Failed to get the "+kind, kind+".Namespace", key.Namespace, kind+".Name", key.Name)
+		return err
+	}
+	err = r.apply(ctx, desired)
+	if err != nil {
+		log.Error(err, "Failed to apply the "+kind, kind+".Namespace", key.Namespace, kind+".Name", key.Name)
+		return err
+	}
+	if !existed {
+		log.Info(kind+" was created", kind+".Namespace", key.Namespace, kind+".Name", key.Name)
 	}
+	r.recordApplied(podinfo, kind, existed, found, desired)
 	return nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
-func (r *PodinfoReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.Podinfo{}).
-		// Owns(&appsv1.Deployment{}).
-		// Owns(&corev1.Service{}).
-		Complete(r)
+// deleteOwned deletes the object if it exists and is controlled by the podinfo, the returned bool says
+// if the object was deleted
+func (r *PodinfoReconciler) deleteOwned(ctx context.Context, podinfo *v1beta1.Podinfo, key client.ObjectKey, obj client.Object) (bool, error) {
+	err := r.Get(ctx, key, obj)
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	// objects without a controller are not ours to remove
+	if owner := metav1.GetControllerOf(obj); owner == nil || owner.UID != podinfo.UID {
+		return false, nil
+	}
+	err = r.Delete(ctx, obj)
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return true, nil
+}
+
+// apply server-side applies the object with the operator's field manager, obj is updated with the result
+func (r *PodinfoReconciler) apply(ctx context.Context, obj client.Object) error {
+	return r.Patch(ctx, obj, client.Apply, client.ForceOwnership, client.FieldOwner(FieldManager))
+}
+
+// checkOwnership returns an error if the object is controlled by anything else than the podinfo. Objects
+// without a controller are adopted only if they carry the labels the operator puts on the objects it generates
+// (e.g. orphaned when an earlier podinfo was deleted), unrelated objects sharing the name are left alone.
+func checkOwnership(obj metav1.Object, podinfo *v1beta1.Podinfo) error {
+	owner := metav1.GetControllerOf(obj)
+	if owner == nil {
+		if generatedBy(obj, podinfo) {
+			return nil
+		}
+		return fmt.Errorf("%s/%s already exists and wasn't created by the operator", obj.GetNamespace(), obj.GetName())
+	}
+	if owner.UID == podinfo.UID {
+		return nil
+	}
+	return fmt.Errorf("%s/%s already exists and is controlled by %s %s", obj.GetNamespace(), obj.GetName(), owner.Kind, owner.Name)
+}
+
+// generatedBy returns true if the object carries the labels the operator generates for the podinfo, i.e. the
+// managed-by label of the operator and the app label equal to the object name or, on the Prometheus Operator
+// objects, the instance label of the podinfo. The app and instance labels alone are common (e.g. set by Helm
+// charts) and don't tell the objects of the operator apart.
+func generatedBy(obj metav1.Object, podinfo *v1beta1.Podinfo) bool {
+	labels := obj.GetLabels()
+	if labels[utils.ManagedByLabel] != utils.ManagedBy {
+		return false
+	}
+	return labels["app"] == obj.GetName() || labels["app.kubernetes.io/instance"] == podinfo.Name
+}
+
+// SetupWithManager sets up the controller with the Manager. The Prometheus Operator objects are watched
+// only if their CRDs are installed when the operator starts. The context bounds the lookups of the podinfoes
+// referring to the watched ConfigMaps and Secrets.
+func (r *PodinfoReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &v1beta1.Podinfo{}, configReferencesField, indexConfigReferences); err != nil {
+		return err
+	}
+	controller := ctrl.NewControllerManagedBy(mgr).
+		For(&v1beta1.Podinfo{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.Service{}).
+		Owns(&networkingv1.Ingress{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Owns(&autoscalingv2beta2.HorizontalPodAutoscaler{}).
+		Owns(&policyv1beta1.PodDisruptionBudget{}).
+		// the tiers are rolled out when the ConfigMaps and Secrets of their environment change, only the
+		// metadata of them is cached, the content is read from the API server when it's hashed
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.podinfoesReferring(ctx, false)), builder.OnlyMetadata).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.podinfoesReferring(ctx, true)), builder.OnlyMetadata)
+	for _, gvk := range []schema.GroupVersionKind{utils.ServiceMonitorGVK, utils.PrometheusRuleGVK} {
+		if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		controller = controller.Owns(obj)
+	}
+	return controller.Complete(r)
 }
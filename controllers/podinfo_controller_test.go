@@ -0,0 +1,1594 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+	"github.com/jkremser/podinfo-operator/controllers/utils"
+)
+
+var _ = Describe("Podinfo controller", func() {
+	var (
+		ctx        context.Context
+		reconciler *PodinfoReconciler
+		recorder   *record.FakeRecorder
+		podinfo    *v1beta1.Podinfo
+		key        types.NamespacedName
+	)
+
+	reconcile := func() error {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		return err
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		recorder = record.NewFakeRecorder(100)
+		reconciler = &PodinfoReconciler{
+			Client:   k8sClient,
+			Scheme:   scheme.Scheme,
+			Recorder: recorder,
+			Log:      ctrl.Log.WithName("podinfo"),
+		}
+		podinfo = &v1beta1.Podinfo{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "podinfo-",
+				Namespace:    "default",
+			},
+			Spec: v1beta1.PodinfoSpec{
+				Frontend: v1beta1.ComponentSpec{Replicas: pointer.Int32Ptr(1)},
+				Backend:  v1beta1.ComponentSpec{Replicas: pointer.Int32Ptr(2)},
+				Message:  "Hello Podinfo",
+			},
+		}
+		Expect(k8sClient.Create(ctx, podinfo)).To(Succeed())
+		key = types.NamespacedName{Name: podinfo.Name, Namespace: podinfo.Namespace}
+	})
+
+	// events drains the events recorded so far
+	events := func() []string {
+		var recorded []string
+		for {
+			select {
+			case event := <-recorder.Events:
+				recorded = append(recorded, event)
+			default:
+				return recorded
+			}
+		}
+	}
+
+	// markRolledOut does the job of the deployment controller, which doesn't run in the test environment
+	markRolledOut := func(suffix string) {
+		deployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + suffix, Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+		replicas := *deployment.Spec.Replicas
+		deployment.Status.ObservedGeneration = deployment.Generation
+		deployment.Status.Replicas = replicas
+		deployment.Status.UpdatedReplicas = replicas
+		deployment.Status.ReadyReplicas = replicas
+		deployment.Status.AvailableReplicas = replicas
+		Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+	}
+
+	Context("status", func() {
+		It("reports per-tier readiness and conditions", func() {
+			Expect(reconcile()).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.ObservedGeneration).To(Equal(podinfo.Generation))
+			Expect(podinfo.Status.Backend).To(Equal(v1beta1.TierStatus{Replicas: 2, ReadyReplicas: 0, Ready: "0/2"}))
+			Expect(podinfo.Status.Frontend).To(Equal(v1beta1.TierStatus{Replicas: 1, ReadyReplicas: 0, Ready: "0/1"}))
+			Expect(meta.IsStatusConditionFalse(podinfo.Status.Conditions, v1beta1.ConditionReady)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(podinfo.Status.Conditions, v1beta1.ConditionProgressing)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(podinfo.Status.Conditions, v1beta1.ConditionDegraded)).To(BeTrue())
+
+			By("marking the deployments as rolled out")
+			markRolledOut("-be")
+			markRolledOut("-fe")
+			Expect(reconcile()).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.Backend.Ready).To(Equal("2/2"))
+			Expect(podinfo.Status.Frontend.Ready).To(Equal("1/1"))
+			Expect(meta.IsStatusConditionTrue(podinfo.Status.Conditions, v1beta1.ConditionReady)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(podinfo.Status.Conditions, v1beta1.ConditionProgressing)).To(BeTrue())
+			Expect(testutil.ToFloat64(tierReadyReplicas.WithLabelValues(podinfo.Namespace, podinfo.Name, "backend"))).To(Equal(2.0))
+			Expect(testutil.ToFloat64(tierReadyReplicas.WithLabelValues(podinfo.Namespace, podinfo.Name, "frontend"))).To(Equal(1.0))
+		})
+	})
+
+	Context("ownership", func() {
+		It("sets the podinfo as the controller of the generated objects", func() {
+			Expect(reconcile()).To(Succeed())
+
+			for _, suffix := range []string{"-be", "-fe"} {
+				objKey := types.NamespacedName{Name: podinfo.Name + suffix, Namespace: podinfo.Namespace}
+				for _, obj := range []client.Object{&appsv1.Deployment{}, &corev1.Service{}} {
+					Expect(k8sClient.Get(ctx, objKey, obj)).To(Succeed())
+					owner := metav1.GetControllerOf(obj)
+					Expect(owner).NotTo(BeNil())
+					Expect(owner.UID).To(Equal(podinfo.UID))
+					Expect(owner.Kind).To(Equal("Podinfo"))
+				}
+			}
+		})
+
+		It("refuses to take over objects controlled by someone else", func() {
+			foreign := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{GenerateName: "foreign-", Namespace: podinfo.Namespace},
+			}
+			Expect(k8sClient.Create(ctx, foreign)).To(Succeed())
+			deployment, err := utils.DefaultTemplates().PodinfoDeployment(podinfo, true, utils.PodinfoVersion)
+			Expect(err).NotTo(HaveOccurred())
+			deployment.OwnerReferences = []metav1.OwnerReference{
+				*metav1.NewControllerRef(foreign, corev1.SchemeGroupVersion.WithKind("ConfigMap")),
+			}
+			Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+			Expect(reconcile()).To(MatchError(ContainSubstring("is controlled by ConfigMap")))
+		})
+
+		It("leaves unrelated objects sharing the name alone", func() {
+			labels := map[string]string{"team": "other"}
+			unrelated := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace, Labels: labels},
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: labels},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: labels},
+						Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: "nginx"}}},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, unrelated)).To(Succeed())
+			before := unrelated.DeepCopy()
+
+			Expect(reconcile()).To(MatchError(ContainSubstring("wasn't created by the operator")))
+			Expect(events()).To(ContainElement(HavePrefix("Warning ReconcileFailed ")))
+			found := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(unrelated), found)).To(Succeed())
+			Expect(found.ResourceVersion).To(Equal(before.ResourceVersion))
+			Expect(found.OwnerReferences).To(BeEmpty())
+			Expect(found.Spec.Template.Spec.Containers).To(Equal(before.Spec.Template.Spec.Containers))
+
+			By("leaving the objects of a Helm release named like the podinfo alone")
+			Expect(k8sClient.Delete(ctx, found)).To(Succeed())
+			labels = map[string]string{
+				"app":                          podinfo.Name + "-be",
+				"app.kubernetes.io/instance":   podinfo.Name,
+				"app.kubernetes.io/managed-by": "Helm",
+			}
+			helm := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace, Labels: labels},
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": podinfo.Name + "-be"}},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: labels},
+						Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "podinfo", Image: "ghcr.io/stefanprodan/podinfo:4.0.0"}}},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, helm)).To(Succeed())
+			before = helm.DeepCopy()
+			Expect(reconcile()).To(MatchError(ContainSubstring("wasn't created by the operator")))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(helm), found)).To(Succeed())
+			Expect(found.ResourceVersion).To(Equal(before.ResourceVersion))
+			Expect(found.OwnerReferences).To(BeEmpty())
+			Expect(found.Labels).To(Equal(before.Labels))
+			Expect(found.Spec.Template.Spec.Containers).To(Equal(before.Spec.Template.Spec.Containers))
+
+			By("adopting the objects carrying the operator's labels")
+			Expect(k8sClient.Delete(ctx, found)).To(Succeed())
+			labels = map[string]string{"app": podinfo.Name + "-be", utils.ManagedByLabel: utils.ManagedBy}
+			generated := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace, Labels: labels},
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": podinfo.Name + "-be"}},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: labels},
+						Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "podinfo", Image: "ghcr.io/stefanprodan/podinfo:5.0.0"}}},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, generated)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(generated), found)).To(Succeed())
+			Expect(metav1.GetControllerOf(found)).NotTo(BeNil())
+			Expect(metav1.GetControllerOf(found).UID).To(Equal(podinfo.UID))
+		})
+	})
+
+	Context("version", func() {
+		image := func(suffix string) string {
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + suffix, Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+			return deployment.Spec.Template.Spec.Containers[0].Image
+		}
+
+		It("deploys the operator's default version unless the podinfo specifies one", func() {
+			reconciler.DefaultVersion = "5.1.0"
+			Expect(reconcile()).To(Succeed())
+			Expect(image("-be")).To(Equal("ghcr.io/stefanprodan/podinfo:5.1.0"))
+			Expect(image("-fe")).To(Equal("ghcr.io/stefanprodan/podinfo:5.1.0"))
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.Version = "5.2.0"
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			markRolledOut("-be")
+			markRolledOut("-fe")
+			Expect(reconcile()).To(Succeed())
+			Expect(image("-be")).To(Equal("ghcr.io/stefanprodan/podinfo:5.2.0"))
+		})
+
+		It("upgrades the backend first and the frontend once the backend is available", func() {
+			podinfo.Spec.Version = "5.2.0"
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			markRolledOut("-be")
+			markRolledOut("-fe")
+			Expect(reconcile()).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.Backend.Version).To(Equal("5.2.0"))
+			Expect(podinfo.Status.Frontend.Version).To(Equal("5.2.0"))
+
+			By("bumping the version")
+			podinfo.Spec.Version = "5.2.1"
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			Expect(image("-be")).To(Equal("ghcr.io/stefanprodan/podinfo:5.2.1"))
+			Expect(image("-fe")).To(Equal("ghcr.io/stefanprodan/podinfo:5.2.0"))
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.Backend.Version).To(Equal("5.2.0"))
+			Expect(podinfo.Status.Frontend.Version).To(Equal("5.2.0"))
+
+			By("waiting for the backend to become available")
+			Expect(reconcile()).To(Succeed())
+			Expect(image("-fe")).To(Equal("ghcr.io/stefanprodan/podinfo:5.2.0"))
+			markRolledOut("-be")
+			Expect(reconcile()).To(Succeed())
+			Expect(image("-fe")).To(Equal("ghcr.io/stefanprodan/podinfo:5.2.1"))
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.Backend.Version).To(Equal("5.2.1"))
+			Expect(podinfo.Status.Frontend.Version).To(Equal("5.2.0"))
+
+			markRolledOut("-fe")
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.Frontend.Version).To(Equal("5.2.1"))
+		})
+	})
+
+	Context("ingress", func() {
+		ingressKey := func() types.NamespacedName {
+			return types.NamespacedName{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}
+		}
+
+		It("exposes the frontend and reports the URL", func() {
+			className := "nginx"
+			podinfo.Spec.Ingress = &v1beta1.IngressSpec{
+				Host:             "podinfo.example.com",
+				Path:             "/podinfo",
+				IngressClassName: &className,
+				TLSSecretName:    "podinfo-tls",
+				Annotations:      map[string]string{"cert-manager.io/cluster-issuer": "letsencrypt"},
+			}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			ingress := &networkingv1.Ingress{}
+			Expect(k8sClient.Get(ctx, ingressKey(), ingress)).To(Succeed())
+			Expect(metav1.GetControllerOf(ingress).UID).To(Equal(podinfo.UID))
+			Expect(ingress.Annotations).To(HaveKeyWithValue("cert-manager.io/cluster-issuer", "letsencrypt"))
+			Expect(*ingress.Spec.IngressClassName).To(Equal("nginx"))
+			Expect(ingress.Spec.TLS).To(ConsistOf(networkingv1.IngressTLS{Hosts: []string{"podinfo.example.com"}, SecretName: "podinfo-tls"}))
+			Expect(ingress.Spec.Rules).To(HaveLen(1))
+			Expect(ingress.Spec.Rules[0].Host).To(Equal("podinfo.example.com"))
+			path := ingress.Spec.Rules[0].HTTP.Paths[0]
+			Expect(path.Path).To(Equal("/podinfo"))
+			Expect(path.Backend.Service.Name).To(Equal(podinfo.Name + "-fe"))
+			Expect(path.Backend.Service.Port.Name).To(Equal("http"))
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.URL).To(Equal("https://podinfo.example.com/podinfo"))
+		})
+
+		It("reports the address assigned by the ingress controller when there's no host", func() {
+			podinfo.Spec.Ingress = &v1beta1.IngressSpec{}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.URL).To(BeEmpty())
+
+			ingress := &networkingv1.Ingress{}
+			Expect(k8sClient.Get(ctx, ingressKey(), ingress)).To(Succeed())
+			ingress.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+			Expect(k8sClient.Status().Update(ctx, ingress)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.URL).To(Equal("http://10.0.0.1/"))
+		})
+
+		It("removes the ingress when it's no longer requested", func() {
+			podinfo.Spec.Ingress = &v1beta1.IngressSpec{Host: "podinfo.example.com"}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Get(ctx, ingressKey(), &networkingv1.Ingress{})).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.Ingress = nil
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			err := k8sClient.Get(ctx, ingressKey(), &networkingv1.Ingress{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			updated := &v1beta1.Podinfo{}
+			Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+			Expect(updated.Status.URL).To(BeEmpty())
+		})
+	})
+
+	Context("autoscaling", func() {
+		It("creates the autoscaler and leaves the replicas to it", func() {
+			podinfo.Spec.Frontend.Replicas = pointer.Int32Ptr(3)
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			feKey := types.NamespacedName{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}
+
+			By("enabling the autoscaling")
+			rps := resource.MustParse("10")
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.Frontend.Autoscaling = &v1beta1.AutoscalingSpec{
+				MinReplicas:                    pointer.Int32Ptr(2),
+				MaxReplicas:                    5,
+				TargetCPUUtilizationPercentage: pointer.Int32Ptr(70),
+				TargetHTTPRequestsPerSecond:    &rps,
+			}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+			Expect(k8sClient.Get(ctx, feKey, hpa)).To(Succeed())
+			Expect(metav1.GetControllerOf(hpa).UID).To(Equal(podinfo.UID))
+			Expect(hpa.Spec.ScaleTargetRef.Name).To(Equal(podinfo.Name + "-fe"))
+			Expect(*hpa.Spec.MinReplicas).To(Equal(int32(2)))
+			Expect(hpa.Spec.MaxReplicas).To(Equal(int32(5)))
+			// the order of the metrics isn't preserved by the API server
+			Expect(hpa.Spec.Metrics).To(HaveLen(2))
+			for _, metric := range hpa.Spec.Metrics {
+				switch metric.Type {
+				case autoscalingv2beta2.ResourceMetricSourceType:
+					Expect(metric.Resource.Name).To(Equal(corev1.ResourceCPU))
+					Expect(*metric.Resource.Target.AverageUtilization).To(Equal(int32(70)))
+				case autoscalingv2beta2.PodsMetricSourceType:
+					Expect(metric.Pods.Metric.Name).To(Equal(utils.HTTPRequestsMetric))
+					Expect(metric.Pods.Target.AverageValue.String()).To(Equal("10"))
+				default:
+					Fail("unexpected metric type " + string(metric.Type))
+				}
+			}
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, feKey, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(3)))
+
+			By("scaling the deployment like the autoscaler does")
+			deployment.Spec.Replicas = pointer.Int32Ptr(4)
+			Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Get(ctx, feKey, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(4)))
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.Frontend.Replicas).To(Equal(int32(4)))
+
+			By("disabling the autoscaling")
+			podinfo.Spec.Frontend.Autoscaling = nil
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			err := k8sClient.Get(ctx, feKey, &autoscalingv2beta2.HorizontalPodAutoscaler{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, feKey, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(3)))
+		})
+	})
+
+	Context("cache", func() {
+		It("deploys the cache, wires it into the backend and reports its readiness", func() {
+			podinfo.Spec.Cache = &v1beta1.CacheSpec{}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			cacheKey := types.NamespacedName{Name: podinfo.Name + "-cache", Namespace: podinfo.Namespace}
+			beKey := types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}
+			cacheServer := "--cache-server=tcp://" + podinfo.Name + "-cache:6379"
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, cacheKey, deployment)).To(Succeed())
+			Expect(metav1.GetControllerOf(deployment).UID).To(Equal(podinfo.UID))
+			Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal(utils.CacheImage))
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, cacheKey, service)).To(Succeed())
+			Expect(service.Spec.Ports[0].Port).To(Equal(int32(utils.CachePort)))
+			backend := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, beKey, backend)).To(Succeed())
+			Expect(backend.Spec.Template.Spec.Containers[0].Command).To(ContainElement(cacheServer))
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.Cache).To(Equal(&v1beta1.TierStatus{Replicas: 1, Ready: "0/1"}))
+
+			By("marking the tiers as rolled out")
+			markRolledOut("-be")
+			markRolledOut("-fe")
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(podinfo.Status.Conditions, v1beta1.ConditionReady)).To(BeTrue())
+			markRolledOut("-cache")
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.Cache.Ready).To(Equal("1/1"))
+			Expect(meta.IsStatusConditionTrue(podinfo.Status.Conditions, v1beta1.ConditionReady)).To(BeTrue())
+
+			By("dropping the cache")
+			podinfo.Spec.Cache = nil
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			err := k8sClient.Get(ctx, cacheKey, &appsv1.Deployment{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			err = k8sClient.Get(ctx, cacheKey, &corev1.Service{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			backend = &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, beKey, backend)).To(Succeed())
+			Expect(backend.Spec.Template.Spec.Containers[0].Command).NotTo(ContainElement(cacheServer))
+			podinfo = &v1beta1.Podinfo{}
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.Cache).To(BeNil())
+		})
+	})
+
+	Context("monitoring", func() {
+		It("skips the monitoring without the CRDs and scrapes both tiers once they're installed", func() {
+			podinfo.Spec.Monitoring = &v1beta1.MonitoringSpec{
+				Interval: "15s",
+				Labels:   map[string]string{"release": "prometheus"},
+				Alerts:   &v1beta1.AlertsSpec{ErrorRatePercent: pointer.Int32Ptr(10)},
+			}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			Expect(events()).To(ContainElements(
+				HavePrefix("Warning MonitoringUnavailable ServiceMonitor can't be created"),
+				HavePrefix("Warning MonitoringUnavailable PrometheusRule can't be created"),
+			))
+
+			By("installing the Prometheus Operator CRDs")
+			_, err := envtest.InstallCRDs(testEnv.Config, envtest.CRDInstallOptions{
+				Paths:              []string{filepath.Join("testdata", "monitoring.coreos.com.yaml")},
+				ErrorIfPathMissing: true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			monitor := &unstructured.Unstructured{}
+			monitor.SetGroupVersionKind(utils.ServiceMonitorGVK)
+			Eventually(func() error {
+				if err := reconcile(); err != nil {
+					return err
+				}
+				return k8sClient.Get(ctx, key, monitor)
+			}, 10*time.Second).Should(Succeed())
+
+			Expect(metav1.GetControllerOf(monitor).UID).To(Equal(podinfo.UID))
+			Expect(monitor.GetLabels()).To(HaveKeyWithValue("release", "prometheus"))
+			endpoints, _, _ := unstructured.NestedSlice(monitor.Object, "spec", "endpoints")
+			Expect(endpoints).To(ConsistOf(map[string]interface{}{"port": "http-metrics", "path": "/metrics", "interval": "15s"}))
+			values, _, _ := unstructured.NestedSlice(monitor.Object, "spec", "selector", "matchExpressions")
+			Expect(values).To(HaveLen(1))
+			Expect(values[0]).To(HaveKeyWithValue("values", ConsistOf(podinfo.Name+"-fe", podinfo.Name+"-be")))
+			for _, suffix := range []string{"-fe", "-be"} {
+				svc := &corev1.Service{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + suffix, Namespace: podinfo.Namespace}, svc)).To(Succeed())
+				Expect(svc.Spec.Ports[len(svc.Spec.Ports)-1].Name).To(Equal("http-metrics"))
+			}
+
+			rule := &unstructured.Unstructured{}
+			rule.SetGroupVersionKind(utils.PrometheusRuleGVK)
+			Expect(k8sClient.Get(ctx, key, rule)).To(Succeed())
+			groups, _, _ := unstructured.NestedSlice(rule.Object, "spec", "groups")
+			Expect(groups).To(HaveLen(1))
+			rules, _, _ := unstructured.NestedSlice(groups[0].(map[string]interface{}), "rules")
+			Expect(rules).To(HaveLen(2))
+			Expect(rules[0]).To(HaveKeyWithValue("expr", HaveSuffix("> 10")))
+			Expect(rules[1]).To(HaveKeyWithValue("expr", HaveSuffix("> 0.5")))
+			Expect(rules[1]).To(HaveKeyWithValue("for", "300s"))
+
+			By("dropping the alerts and then the monitoring")
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.Monitoring.Alerts = nil
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			err = k8sClient.Get(ctx, key, rule)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, key, monitor)).To(Succeed())
+
+			podinfo = &v1beta1.Podinfo{}
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.Monitoring = nil
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			err = k8sClient.Get(ctx, key, monitor)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	Context("pod disruption budget", func() {
+		It("creates, updates and removes the budget of the tier", func() {
+			podinfo.Spec.Backend.Replicas = pointer.Int32Ptr(3)
+			minAvailable := intstr.FromInt(2)
+			podinfo.Spec.Backend.PodDisruptionBudget = &v1beta1.PodDisruptionBudgetSpec{MinAvailable: &minAvailable}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			beKey := types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}
+
+			pdb := &policyv1beta1.PodDisruptionBudget{}
+			Expect(k8sClient.Get(ctx, beKey, pdb)).To(Succeed())
+			Expect(metav1.GetControllerOf(pdb).UID).To(Equal(podinfo.UID))
+			Expect(pdb.Spec.Selector.MatchLabels).To(Equal(map[string]string{"app": podinfo.Name + "-be"}))
+			Expect(pdb.Spec.MinAvailable.IntValue()).To(Equal(2))
+			Expect(pdb.Spec.MaxUnavailable).To(BeNil())
+			feKey := types.NamespacedName{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}
+			err := k8sClient.Get(ctx, feKey, &policyv1beta1.PodDisruptionBudget{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+			By("switching to maxUnavailable")
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			maxUnavailable := intstr.FromString("50%")
+			podinfo.Spec.Backend.PodDisruptionBudget = &v1beta1.PodDisruptionBudgetSpec{MaxUnavailable: &maxUnavailable}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			pdb = &policyv1beta1.PodDisruptionBudget{}
+			Expect(k8sClient.Get(ctx, beKey, pdb)).To(Succeed())
+			Expect(pdb.Spec.MinAvailable).To(BeNil())
+			Expect(pdb.Spec.MaxUnavailable.String()).To(Equal("50%"))
+
+			By("dropping the budget")
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.Backend.PodDisruptionBudget = nil
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			err = k8sClient.Get(ctx, beKey, &policyv1beta1.PodDisruptionBudget{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	Context("network policy", func() {
+		It("lets only the frontend reach the backend and opens the metrics to the configured sources", func() {
+			prometheus := networkingv1.NetworkPolicyPeer{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"name": "monitoring"}},
+			}
+			ingressController := networkingv1.NetworkPolicyPeer{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"name": "ingress-nginx"}},
+			}
+			podinfo.Spec.NetworkPolicy = &v1beta1.NetworkPolicySpec{
+				Enabled:      true,
+				FrontendFrom: []networkingv1.NetworkPolicyPeer{ingressController},
+				MetricsFrom:  []networkingv1.NetworkPolicyPeer{prometheus},
+			}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			beKey := types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}
+			feKey := types.NamespacedName{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}
+			ports := func(rule networkingv1.NetworkPolicyIngressRule) []string {
+				var names []string
+				for _, port := range rule.Ports {
+					names = append(names, port.Port.String())
+				}
+				return names
+			}
+
+			policy := &networkingv1.NetworkPolicy{}
+			Expect(k8sClient.Get(ctx, beKey, policy)).To(Succeed())
+			Expect(metav1.GetControllerOf(policy).UID).To(Equal(podinfo.UID))
+			Expect(policy.Spec.PodSelector.MatchLabels).To(Equal(map[string]string{"app": podinfo.Name + "-be"}))
+			Expect(policy.Spec.Ingress).To(HaveLen(2))
+			Expect(policy.Spec.Ingress[0].From).To(HaveLen(1))
+			Expect(policy.Spec.Ingress[0].From[0].PodSelector.MatchLabels).To(Equal(map[string]string{"app": podinfo.Name + "-fe"}))
+			Expect(ports(policy.Spec.Ingress[0])).To(Equal([]string{"http", "grpc"}))
+			Expect(policy.Spec.Ingress[1].From).To(Equal([]networkingv1.NetworkPolicyPeer{prometheus}))
+			Expect(ports(policy.Spec.Ingress[1])).To(Equal([]string{"http-metrics"}))
+
+			policy = &networkingv1.NetworkPolicy{}
+			Expect(k8sClient.Get(ctx, feKey, policy)).To(Succeed())
+			Expect(policy.Spec.Ingress).To(HaveLen(2))
+			Expect(policy.Spec.Ingress[0].From).To(Equal([]networkingv1.NetworkPolicyPeer{ingressController}))
+			Expect(ports(policy.Spec.Ingress[0])).To(Equal([]string{"http"}))
+
+			By("disabling the network policies")
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.NetworkPolicy.Enabled = false
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			for _, k := range []types.NamespacedName{beKey, feKey} {
+				err := k8sClient.Get(ctx, k, &networkingv1.NetworkPolicy{})
+				Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			}
+		})
+	})
+
+	Context("templates", func() {
+		It("renders the deployments from the override templates", func() {
+			templates, err := utils.NewTemplates(map[string]string{utils.DeploymentTemplate: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Name }}
+  annotations:
+    podinfo.example.com/message: {{ quote .Podinfo.Spec.Message }}
+spec:
+  template:
+    spec:
+      containers:
+      - name: podinfo
+        image: {{ .Image }}
+`})
+			Expect(err).NotTo(HaveOccurred())
+			reconciler.Templates = templates
+			Expect(reconcile()).To(Succeed())
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+			Expect(deployment.Annotations).To(HaveKeyWithValue("podinfo.example.com/message", "Hello Podinfo"))
+			Expect(deployment.Spec.Selector.MatchLabels).To(Equal(map[string]string{"app": podinfo.Name + "-be"}))
+			Expect(deployment.Spec.Template.Labels).To(HaveKeyWithValue(utils.VersionLabel, utils.PodinfoVersion))
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+			Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:" + utils.PodinfoVersion))
+			Expect(metav1.GetControllerOf(deployment).UID).To(Equal(podinfo.UID))
+		})
+
+		It("keeps the pod settings of the override templates the spec doesn't set", func() {
+			templates, err := utils.NewTemplates(map[string]string{utils.DeploymentTemplate: `
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+      - name: podinfo
+        image: {{ .Image }}
+        imagePullPolicy: Always
+      imagePullSecrets:
+      - name: registry
+      nodeSelector:
+        pool: podinfo
+      tolerations:
+      - key: dedicated
+        value: podinfo
+        effect: NoSchedule
+      affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+            - matchExpressions:
+              - key: kubernetes.io/os
+                operator: In
+                values: [linux]
+      topologySpreadConstraints:
+      - maxSkew: 1
+        topologyKey: kubernetes.io/hostname
+        whenUnsatisfiable: ScheduleAnyway
+`})
+			Expect(err).NotTo(HaveOccurred())
+			reconciler.Templates = templates
+			podinfo.Spec.Frontend.NodeSelector = map[string]string{"pool": "frontend"}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+			pod := deployment.Spec.Template.Spec
+			Expect(pod.Containers[0].ImagePullPolicy).To(Equal(corev1.PullAlways))
+			Expect(pod.ImagePullSecrets).To(Equal([]corev1.LocalObjectReference{{Name: "registry"}}))
+			Expect(pod.NodeSelector).To(Equal(map[string]string{"pool": "podinfo"}))
+			Expect(pod.Tolerations).To(HaveLen(1))
+			Expect(pod.Affinity).NotTo(BeNil())
+			Expect(pod.Affinity.NodeAffinity).NotTo(BeNil())
+			Expect(pod.TopologySpreadConstraints).To(HaveLen(1))
+
+			By("overriding them by the spec of the tier")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.NodeSelector).To(Equal(map[string]string{"pool": "frontend"}))
+			Expect(deployment.Spec.Template.Spec.Tolerations).To(HaveLen(1))
+		})
+
+		It("applies the spec to the podinfo container wherever the template puts it", func() {
+			templates, err := utils.NewTemplates(map[string]string{utils.DeploymentTemplate: `
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+      - name: proxy
+        image: envoyproxy/envoy:v1.17.0
+      - name: podinfo
+        image: {{ .Image }}
+        command: [./podinfo]
+`})
+			Expect(err).NotTo(HaveOccurred())
+			reconciler.Templates = templates
+			podinfo.Spec.Backend.Image = "registry.example.com/podinfo:5.2.1"
+			podinfo.Spec.Backend.Env = []corev1.EnvVar{{Name: "EXTRA", Value: "value"}}
+			podinfo.Spec.Backend.Config = &v1beta1.PodinfoConfig{RandomError: true}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+			proxy, container := deployment.Spec.Template.Spec.Containers[0], deployment.Spec.Template.Spec.Containers[1]
+			Expect(proxy.Image).To(Equal("envoyproxy/envoy:v1.17.0"))
+			Expect(proxy.Env).To(BeEmpty())
+			Expect(proxy.Command).To(BeEmpty())
+			Expect(container.Image).To(Equal("registry.example.com/podinfo:5.2.1"))
+			Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "EXTRA", Value: "value"}))
+			Expect(container.Command).To(Equal([]string{"./podinfo", "--random-error"}))
+		})
+
+		It("refuses templates rendering unexpected objects", func() {
+			_, err := utils.NewTemplates(map[string]string{utils.ServiceTemplate: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Name }}
+`})
+			Expect(err).To(MatchError(ContainSubstring("expected v1 Service")))
+
+			_, err = utils.NewTemplates(map[string]string{utils.DeploymentTemplate: `
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  replica: 1
+`})
+			Expect(err).To(MatchError(ContainSubstring("didn't render a valid Deployment")))
+
+			_, err = utils.NewTemplates(map[string]string{utils.DeploymentTemplate: `
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: {{ .Image }}
+`})
+			Expect(err).To(MatchError(ContainSubstring("without the podinfo container")))
+
+			_, err = utils.NewTemplates(map[string]string{"ingress.yaml": ""})
+			Expect(err).To(MatchError(ContainSubstring("unknown template ingress.yaml")))
+		})
+
+		It("stalls the podinfoes the templates can't be rendered for", func() {
+			templates, err := utils.NewTemplates(map[string]string{utils.ServiceTemplate: `
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Name }}
+  labels:
+    team: {{ index .Podinfo.Annotations "team" }}
+spec:
+  ports:
+  - port: 80
+`})
+			Expect(err).NotTo(HaveOccurred())
+			reconciler.Templates = templates
+			podinfo.Annotations = map[string]string{"team": "{ not: [yaml"}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			stalled := meta.FindStatusCondition(podinfo.Status.Conditions, v1beta1.ConditionStalled)
+			Expect(stalled.Status).To(Equal(metav1.ConditionTrue))
+			Expect(stalled.Message).To(ContainSubstring("service.yaml"))
+		})
+	})
+
+	Context("ui and environment", func() {
+		envOf := func(deployment *appsv1.Deployment) map[string]string {
+			env := map[string]string{}
+			for _, e := range deployment.Spec.Template.Spec.Containers[0].Env {
+				env[e.Name] = e.Value
+			}
+			return env
+		}
+
+		It("configures the UI and the additional environment of the tiers", func() {
+			podinfo.Spec.UI = &v1beta1.UISpec{Color: "#ff0000", LogoURL: "https://example.com/logo.png", Path: "/ui"}
+			podinfo.Spec.Frontend.Env = []corev1.EnvVar{
+				{Name: "PODINFO_UI_COLOR", Value: "#00ff00"},
+				{Name: "EXTRA", Value: "value"},
+			}
+			optional := true
+			envFrom := []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "missing"},
+				Optional:             &optional,
+			}}}
+			podinfo.Spec.Frontend.EnvFrom = envFrom
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+			Expect(envOf(deployment)).To(Equal(map[string]string{
+				"PODINFO_UI_COLOR":   "#ff0000",
+				"PODINFO_UI_MESSAGE": "Hello Podinfo",
+				"PODINFO_UI_LOGO":    "https://example.com/logo.png",
+				"PODINFO_UI_PATH":    "/ui",
+			}))
+			Expect(deployment.Spec.Template.Annotations).NotTo(HaveKey(ConfigHashAnnotation))
+
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+			Expect(envOf(deployment)).To(Equal(map[string]string{
+				"PODINFO_UI_COLOR":   "#00ff00",
+				"PODINFO_UI_MESSAGE": "Hello Podinfo",
+				"PODINFO_UI_LOGO":    "https://example.com/logo.png",
+				"PODINFO_UI_PATH":    "/ui",
+				"EXTRA":              "value",
+			}))
+			Expect(deployment.Spec.Template.Spec.Containers[0].EnvFrom).To(Equal(envFrom))
+			// the missing optional ConfigMap still triggers a rollout once it's created
+			Expect(deployment.Spec.Template.Annotations).To(HaveKey(ConfigHashAnnotation))
+		})
+
+		It("rolls the tier out when a referenced ConfigMap or Secret changes", func() {
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{GenerateName: "podinfo-env-", Namespace: podinfo.Namespace},
+				Data:       map[string]string{"level": "debug"},
+			}
+			Expect(k8sClient.Create(ctx, configMap)).To(Succeed())
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{GenerateName: "podinfo-env-", Namespace: podinfo.Namespace},
+				Data:       map[string][]byte{"PODINFO_TOKEN": []byte("s3cr3t")},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+
+			podinfo.Spec.Backend.Env = []corev1.EnvVar{{
+				Name: "PODINFO_LEVEL",
+				ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: configMap.Name},
+					Key:                  "level",
+				}},
+			}}
+			podinfo.Spec.Backend.EnvFrom = []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: secret.Name}},
+			}}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			backendKey := types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, backendKey, deployment)).To(Succeed())
+			hash := deployment.Spec.Template.Annotations[ConfigHashAnnotation]
+			Expect(hash).NotTo(BeEmpty())
+
+			By("mapping the changed objects to the podinfo")
+			// the podinfoes are looked up by the index of the cache
+			cacheCtx, stopCache := context.WithCancel(ctx)
+			defer stopCache()
+			informers, err := cache.New(cfg, cache.Options{Scheme: scheme.Scheme, Namespace: podinfo.Namespace})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(informers.IndexField(cacheCtx, &v1beta1.Podinfo{}, configReferencesField, indexConfigReferences)).To(Succeed())
+			go func() {
+				defer GinkgoRecover()
+				Expect(informers.Start(cacheCtx)).To(Succeed())
+			}()
+			Expect(informers.WaitForCacheSync(cacheCtx)).To(BeTrue())
+			cached, err := client.NewDelegatingClient(client.NewDelegatingClientInput{CacheReader: informers, Client: k8sClient})
+			Expect(err).NotTo(HaveOccurred())
+			mapper := &PodinfoReconciler{Client: cached, Log: reconciler.Log}
+
+			// the watches cache only the metadata
+			metadata := func(obj client.Object) client.Object {
+				return &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: obj.GetName(), Namespace: obj.GetNamespace()}}
+			}
+			request := ctrl.Request{NamespacedName: key}
+			Expect(mapper.podinfoesReferring(ctx, false)(metadata(configMap))).To(Equal([]ctrl.Request{request}))
+			Expect(mapper.podinfoesReferring(ctx, true)(metadata(secret))).To(Equal([]ctrl.Request{request}))
+			Expect(mapper.podinfoesReferring(ctx, true)(metadata(configMap))).To(BeEmpty())
+
+			By("changing the ConfigMap")
+			configMap.Data["level"] = "info"
+			Expect(k8sClient.Update(ctx, configMap)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Get(ctx, backendKey, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Annotations[ConfigHashAnnotation]).NotTo(Equal(hash))
+			hash = deployment.Spec.Template.Annotations[ConfigHashAnnotation]
+
+			By("changing the Secret")
+			secret.Data["PODINFO_TOKEN"] = []byte("n3w")
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Get(ctx, backendKey, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Annotations[ConfigHashAnnotation]).NotTo(Equal(hash))
+			hash = deployment.Spec.Template.Annotations[ConfigHashAnnotation]
+
+			By("reconciling without changes")
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Get(ctx, backendKey, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Annotations[ConfigHashAnnotation]).To(Equal(hash))
+		})
+	})
+
+	Context("config", func() {
+		It("passes the config of the tier to podinfo and follows the port changes", func() {
+			podinfo.Spec.Backend.Config = &v1beta1.PodinfoConfig{
+				Level:             "debug",
+				Port:              pointer.Int32Ptr(8080),
+				GRPCPort:          pointer.Int32Ptr(8081),
+				MetricsPort:       pointer.Int32Ptr(8082),
+				H2C:               true,
+				HTTPServerTimeout: &metav1.Duration{Duration: 45 * time.Second},
+				RandomDelay:       &v1beta1.RandomDelaySpec{Min: 10, Max: pointer.Int32Ptr(100), Unit: "ms"},
+				RandomError:       true,
+				StressCPU:         1,
+			}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+			container := deployment.Spec.Template.Spec.Containers[0]
+			Expect(container.Command).To(ContainElements(
+				"--port=8080", "--grpc-port=8081", "--port-metrics=8082", "--level=debug", "--h2c",
+				"--http-server-timeout=45s", "--random-delay", "--random-delay-min=10", "--random-delay-max=100",
+				"--random-delay-unit=ms", "--random-error", "--stress-cpu=1",
+			))
+			Expect(container.Command).NotTo(ContainElement(HavePrefix("--stress-memory")))
+			ports := map[string]int32{}
+			for _, port := range container.Ports {
+				ports[port.Name] = port.ContainerPort
+			}
+			Expect(ports).To(Equal(map[string]int32{"http": 8080, "grpc": 8081, "http-metrics": 8082}))
+			Expect(container.LivenessProbe.Exec.Command).To(ContainElement("localhost:8080/healthz"))
+			Expect(container.ReadinessProbe.Exec.Command).To(ContainElement("localhost:8080/readyz"))
+			Expect(deployment.Spec.Template.Annotations).To(HaveKeyWithValue("prometheus.io/port", "8082"))
+
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, service)).To(Succeed())
+			ports = map[string]int32{}
+			for _, port := range service.Spec.Ports {
+				ports[port.Name] = port.Port
+			}
+			Expect(ports).To(Equal(map[string]int32{"http": 8080, "grpc": 8081, "http-metrics": 8082}))
+
+			By("calling the backend on its new port")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Command).To(ContainElements(
+				"--port=9898", "--level=info", fmt.Sprintf("--backend-url=http://%s-be:8080/echo", podinfo.Name),
+			))
+		})
+	})
+
+	Context("fault injection", func() {
+		commandOf := func(suffix string) []string {
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + suffix, Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+			return deployment.Spec.Template.Spec.Containers[0].Command
+		}
+
+		It("injects the faults in the active windows and records them", func() {
+			reconciler.ResyncInterval = time.Hour
+			podinfo.Spec.Backend.Config = &v1beta1.PodinfoConfig{StressCPU: 2}
+			podinfo.Spec.FaultInjection = &v1beta1.FaultInjectionSpec{
+				Interval:    &metav1.Duration{Duration: time.Hour},
+				Duration:    &metav1.Duration{Duration: 30 * time.Minute},
+				RandomError: true,
+				StressCPU:   1,
+			}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			Expect(commandOf("-be")).To(ContainElements("--random-error", "--stress-cpu=1"))
+			Expect(commandOf("-be")).NotTo(ContainElement("--stress-cpu=2"))
+			Expect(commandOf("-fe")).NotTo(ContainElement("--random-error"))
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			created := podinfo.CreationTimestamp.Time
+			status := podinfo.Status.FaultInjection
+			Expect(status).NotTo(BeNil())
+			Expect(status.Active).To(BeTrue())
+			Expect(status.LastWindow.Start.Time).To(BeTemporally("==", created))
+			Expect(status.LastWindow.End.Time).To(BeTemporally("==", created.Add(30*time.Minute)))
+			Expect(status.NextWindowStart.Time).To(BeTemporally("==", created.Add(time.Hour)))
+			Expect(events()).To(ContainElement(fmt.Sprintf("Normal FaultInjectionStarted Injecting faults into the backend until %s",
+				created.Add(30*time.Minute).UTC().Format(time.RFC3339))))
+
+			By("re-examining the podinfo when the window ends")
+			markRolledOut("-be")
+			markRolledOut("-fe")
+			result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("<=", 30*time.Minute))
+			Expect(result.RequeueAfter).To(BeNumerically(">", 29*time.Minute))
+
+			By("turning the faults off when switched to a cron schedule outside of its windows")
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.FaultInjection.Interval = nil
+			podinfo.Spec.FaultInjection.Schedule = "0 0 1 1 *"
+			podinfo.Spec.FaultInjection.Duration = &metav1.Duration{Duration: time.Minute}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			Expect(commandOf("-be")).NotTo(ContainElement("--random-error"))
+			Expect(commandOf("-be")).To(ContainElement("--stress-cpu=2"))
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			status = podinfo.Status.FaultInjection
+			Expect(status.Active).To(BeFalse())
+			Expect(status.LastWindow.Start.Time).To(BeTemporally("==", created))
+			nextYear := time.Date(time.Now().UTC().Year()+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+			Expect(status.NextWindowStart.Time).To(BeTemporally("==", nextYear))
+			Expect(events()).To(ContainElement("Normal FaultInjectionStopped Stopped injecting faults, the next window starts at " +
+				nextYear.Format(time.RFC3339)))
+
+			By("dropping the status once the fault injection is disabled")
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.FaultInjection = nil
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			// decoding into the same object would keep the dropped status
+			podinfo = &v1beta1.Podinfo{}
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.FaultInjection).To(BeNil())
+			Expect(events()).NotTo(ContainElement(HavePrefix("Normal FaultInjection")))
+		})
+
+		It("turns the faults off when the window ends", func() {
+			podinfo.Spec.FaultInjection = &v1beta1.FaultInjectionSpec{
+				Interval:    &metav1.Duration{Duration: time.Hour},
+				Duration:    &metav1.Duration{Duration: 3 * time.Second},
+				RandomError: true,
+			}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(commandOf("-be")).To(ContainElement("--random-error"))
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			end := podinfo.Status.FaultInjection.LastWindow.End.Time
+			Expect(result.RequeueAfter).To(BeNumerically("<=", time.Until(end)+time.Second))
+
+			// reconciles before the end of the window keep the faults on
+			Eventually(func() ([]string, error) {
+				_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+				return commandOf("-be"), err
+			}, 5*time.Second, 500*time.Millisecond).ShouldNot(ContainElement("--random-error"))
+			Expect(time.Now()).To(BeTemporally(">=", end))
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.FaultInjection.Active).To(BeFalse())
+			Expect(podinfo.Status.FaultInjection.NextWindowStart.Time).To(BeTemporally("==", podinfo.CreationTimestamp.Add(time.Hour)))
+			Expect(events()).To(ContainElement(HavePrefix("Normal FaultInjectionStopped ")))
+		})
+
+		It("keeps injecting unscheduled faults into the selected tiers", func() {
+			podinfo.Spec.FaultInjection = &v1beta1.FaultInjectionSpec{
+				Tiers:       v1beta1.FaultInjectionBoth,
+				RandomDelay: &v1beta1.RandomDelaySpec{Max: pointer.Int32Ptr(2)},
+			}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			Expect(commandOf("-be")).To(ContainElements("--random-delay", "--random-delay-min=0", "--random-delay-max=2"))
+			Expect(commandOf("-fe")).To(ContainElements("--random-delay", "--random-delay-min=0", "--random-delay-max=2"))
+			Expect(events()).To(ContainElement("Normal FaultInjectionStarted Injecting faults into the backend and frontend until it's disabled"))
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			window := podinfo.Status.FaultInjection.LastWindow
+			Expect(window.End).To(BeNil())
+			Expect(podinfo.Status.FaultInjection.NextWindowStart).To(BeNil())
+
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Status.FaultInjection.LastWindow).To(Equal(window))
+			Expect(events()).NotTo(ContainElement(HavePrefix("Normal FaultInjectionStarted")))
+		})
+
+		It("computes the windows of the schedules", func() {
+			at := func(hour, min int) time.Time {
+				return time.Date(2021, time.March, 1, hour, min, 0, 0, time.UTC)
+			}
+			minutes := func(m int) *metav1.Duration {
+				return &metav1.Duration{Duration: time.Duration(m) * time.Minute}
+			}
+
+			hourly := &v1beta1.FaultInjectionSpec{Schedule: "0 * * * *", Duration: minutes(10)}
+			Expect(faultInjectionWindow(hourly, at(9, 0), at(12, 5))).To(Equal(faultWindow{active: true, start: at(12, 0), end: at(12, 10), next: at(13, 0)}))
+			Expect(faultInjectionWindow(hourly, at(9, 0), at(12, 30))).To(Equal(faultWindow{next: at(13, 0)}))
+
+			// overlapping windows, the latest one counts
+			overlapping := &v1beta1.FaultInjectionSpec{Schedule: "*/5 * * * *", Duration: minutes(12)}
+			Expect(faultInjectionWindow(overlapping, at(9, 0), at(12, 13))).To(Equal(faultWindow{active: true, start: at(12, 10), end: at(12, 22), next: at(12, 15)}))
+
+			interval := &v1beta1.FaultInjectionSpec{Interval: minutes(60), Duration: minutes(15)}
+			Expect(faultInjectionWindow(interval, at(10, 0), at(12, 10))).To(Equal(faultWindow{active: true, start: at(12, 0), end: at(12, 15), next: at(13, 0)}))
+			Expect(faultInjectionWindow(interval, at(10, 0), at(12, 20))).To(Equal(faultWindow{start: at(12, 0), end: at(12, 15), next: at(13, 0)}))
+
+			Expect(faultInjectionWindow(&v1beta1.FaultInjectionSpec{}, at(10, 0), at(12, 20))).To(Equal(faultWindow{active: true}))
+
+			_, err := faultInjectionWindow(&v1beta1.FaultInjectionSpec{Schedule: "every hour"}, at(10, 0), at(12, 20))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("patches", func() {
+		It("applies the strategic merge and JSON patches of the tier", func() {
+			podinfo.Spec.Backend.Patches = []v1beta1.Patch{{
+				Target: v1beta1.PatchTargetDeployment,
+				Patch: `
+spec:
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        image: busybox
+      volumes:
+      - name: cache
+        emptyDir: {}
+`,
+			}, {
+				Target: v1beta1.PatchTargetService,
+				Patch:  `[{"op": "add", "path": "/metadata/annotations", "value": {"team": "podinfo"}}]`,
+			}, {
+				// renaming is ignored
+				Target: v1beta1.PatchTargetDeployment,
+				Patch:  `[{"op": "replace", "path": "/metadata/name", "value": "renamed"}]`,
+			}}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+			images := map[string]string{}
+			for _, container := range deployment.Spec.Template.Spec.Containers {
+				images[container.Name] = container.Image
+			}
+			Expect(images).To(Equal(map[string]string{
+				"podinfo": "ghcr.io/stefanprodan/podinfo:" + utils.PodinfoVersion,
+				"sidecar": "busybox",
+			}))
+			Expect(deployment.Spec.Template.Spec.Volumes).To(HaveLen(1))
+
+			svc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, svc)).To(Succeed())
+			Expect(svc.Annotations).To(HaveKeyWithValue("team", "podinfo"))
+			frontend := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}, frontend)).To(Succeed())
+			Expect(frontend.Annotations).NotTo(HaveKey("team"))
+		})
+
+		It("reports the patches that can't be applied in the status", func() {
+			podinfo.Spec.Frontend.Patches = []v1beta1.Patch{{
+				Target: v1beta1.PatchTargetDeployment,
+				Patch:  `[{"op": "remove", "path": "/spec/template/spec/initContainers"}]`,
+			}}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			stalled := meta.FindStatusCondition(podinfo.Status.Conditions, v1beta1.ConditionStalled)
+			Expect(stalled.Status).To(Equal(metav1.ConditionTrue))
+			Expect(stalled.Message).To(HavePrefix("spec.frontend.patches[0]: unable to patch the Deployment"))
+			Expect(events()).To(ContainElement(HavePrefix("Warning ReconcileFailed spec.frontend.patches[0]")))
+		})
+	})
+
+	Context("component overrides", func() {
+		It("flows the image, resources and scheduling of the tier into the pod template", func() {
+			toleration := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "podinfo", Effect: corev1.TaintEffectNoSchedule}
+			resources := corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			}
+			podinfo.Spec.Backend.Image = "registry.example.com/podinfo:custom"
+			podinfo.Spec.Backend.ImagePullPolicy = corev1.PullAlways
+			podinfo.Spec.Backend.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}}
+			podinfo.Spec.Backend.Resources = &resources
+			podinfo.Spec.Backend.NodeSelector = map[string]string{"pool": "podinfo"}
+			podinfo.Spec.Backend.Tolerations = []corev1.Toleration{toleration}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			backend := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, backend)).To(Succeed())
+			pod := backend.Spec.Template.Spec
+			Expect(pod.Containers[0].Image).To(Equal("registry.example.com/podinfo:custom"))
+			Expect(pod.Containers[0].ImagePullPolicy).To(Equal(corev1.PullAlways))
+			Expect(pod.Containers[0].Resources.Limits.Memory().String()).To(Equal("1Gi"))
+			Expect(pod.Containers[0].Resources.Requests).To(BeEmpty())
+			Expect(pod.ImagePullSecrets).To(ConsistOf(corev1.LocalObjectReference{Name: "registry"}))
+			Expect(pod.NodeSelector).To(Equal(map[string]string{"pool": "podinfo"}))
+			Expect(pod.Tolerations).To(ConsistOf(toleration))
+
+			By("keeping the defaults of the other tier")
+			frontend := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}, frontend)).To(Succeed())
+			Expect(frontend.Spec.Template.Spec.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:" + utils.PodinfoVersion))
+			Expect(frontend.Spec.Template.Spec.Containers[0].Resources.Limits.Cpu().String()).To(Equal("1"))
+			Expect(frontend.Spec.Template.Spec.Tolerations).To(BeEmpty())
+
+			By("dropping the overrides again")
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.Backend = v1beta1.ComponentSpec{Replicas: podinfo.Spec.Backend.Replicas}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, backend)).To(Succeed())
+			pod = backend.Spec.Template.Spec
+			Expect(pod.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:" + utils.PodinfoVersion))
+			Expect(pod.Containers[0].Resources.Requests.Cpu().String()).To(Equal("100m"))
+			Expect(pod.ImagePullSecrets).To(BeEmpty())
+			Expect(pod.NodeSelector).To(BeEmpty())
+			Expect(pod.Tolerations).To(BeEmpty())
+		})
+	})
+
+	Context("events", func() {
+		It("reports the created and deleted objects and the failures", func() {
+			Expect(reconcile()).To(Succeed())
+			Expect(events()).To(ConsistOf(
+				"Normal Created Created Deployment "+podinfo.Name+"-be",
+				"Normal Created Created Service "+podinfo.Name+"-be",
+				"Normal Created Created Deployment "+podinfo.Name+"-fe",
+				"Normal Created Created Service "+podinfo.Name+"-fe",
+			))
+
+			By("adding and removing an ingress")
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.Ingress = &v1beta1.IngressSpec{Host: "podinfo.example.com"}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			Expect(events()).To(ConsistOf("Normal Created Created Ingress " + podinfo.Name + "-fe"))
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.Ingress = nil
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			Expect(events()).To(ConsistOf("Normal Deleted Deleted Ingress " + podinfo.Name + "-fe"))
+
+			By("failing to take over an object controlled by someone else")
+			owner := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{GenerateName: "foreign-", Namespace: podinfo.Namespace},
+			}
+			Expect(k8sClient.Create(ctx, owner)).To(Succeed())
+			podinfo.Spec.Ingress = &v1beta1.IngressSpec{Host: "podinfo.example.com"}
+			foreign := utils.PodinfoIngress(podinfo)
+			foreign.OwnerReferences = []metav1.OwnerReference{
+				*metav1.NewControllerRef(owner, corev1.SchemeGroupVersion.WithKind("ConfigMap")),
+			}
+			Expect(k8sClient.Create(ctx, foreign)).To(Succeed())
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.Ingress = &v1beta1.IngressSpec{Host: "podinfo.example.com"}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).NotTo(Succeed())
+			Expect(events()).To(ConsistOf(HavePrefix("Warning ReconcileFailed ")))
+		})
+		It("reports every change of an object within the deduplication window", func() {
+			reconciler.Recorder = NewDedupRecorder(recorder, EventDeduplicationWindow)
+			Expect(reconcile()).To(Succeed())
+			events()
+
+			for _, message := range []string{"Hello again", "Hello once more"} {
+				Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+				podinfo.Spec.Message = message
+				Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+				Expect(reconcile()).To(Succeed())
+				Expect(events()).To(ContainElement("Normal Updated Updated Deployment " + podinfo.Name + "-be"))
+			}
+		})
+	})
+
+	Context("service drift", func() {
+		It("corrects manual edits and keeps the cluster assigned fields", func() {
+			Expect(reconcile()).To(Succeed())
+
+			svc := &corev1.Service{}
+			svcKey := types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}
+			Expect(k8sClient.Get(ctx, svcKey, svc)).To(Succeed())
+			clusterIP := svc.Spec.ClusterIP
+			Expect(clusterIP).NotTo(BeEmpty())
+
+			svc.Spec.Selector = map[string]string{"app": "something-else"}
+			svc.Spec.Ports[0].Port = 8080
+			svc.Spec.Ports[0].TargetPort = intstr.FromInt(8080)
+			Expect(k8sClient.Update(ctx, svc)).To(Succeed())
+
+			Expect(reconcile()).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, svcKey, svc)).To(Succeed())
+			Expect(svc.Spec.ClusterIP).To(Equal(clusterIP))
+			Expect(svc.Spec.Selector).To(Equal(map[string]string{"app": podinfo.Name + "-be"}))
+			Expect(svc.Spec.Ports[0].Port).To(BeEquivalentTo(9898))
+			Expect(svc.Spec.Ports[0].TargetPort).To(Equal(intstr.FromString("http")))
+			Expect(events()).To(ContainElement(ContainSubstring(ReasonDriftCorrected)))
+		})
+
+		It("leaves services in the desired state untouched", func() {
+			Expect(reconcile()).To(Succeed())
+			events()
+			Expect(reconcile()).To(Succeed())
+			Expect(events()).To(BeEmpty())
+		})
+	})
+
+	Context("server-side apply", func() {
+		It("preserves the fields set by other field managers", func() {
+			Expect(reconcile()).To(Succeed())
+
+			deployment := &appsv1.Deployment{}
+			deploymentKey := types.NamespacedName{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}
+			Expect(k8sClient.Get(ctx, deploymentKey, deployment)).To(Succeed())
+			deployment.Annotations = map[string]string{"example.com/owner": "team-a"}
+			deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers, corev1.Container{
+				Name:  "sidecar",
+				Image: "envoyproxy/envoy:v1.17.0",
+			})
+			Expect(k8sClient.Update(ctx, deployment, client.FieldOwner("sidecar-injector"))).To(Succeed())
+
+			svc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, deploymentKey, svc)).To(Succeed())
+			svc.Annotations = map[string]string{"example.com/owner": "team-a"}
+			Expect(k8sClient.Update(ctx, svc, client.FieldOwner("kubectl-annotate"))).To(Succeed())
+
+			By("changing the podinfo")
+			events()
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			podinfo.Spec.Message = "Hello again"
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, deploymentKey, deployment)).To(Succeed())
+			Expect(deployment.Annotations).To(HaveKeyWithValue("example.com/owner", "team-a"))
+			Expect(deployment.Spec.Template.Spec.Containers).To(HaveLen(2))
+			Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "PODINFO_UI_MESSAGE", Value: "Hello again"}))
+			Expect(deployment.Spec.Template.Spec.Containers[1].Name).To(Equal("sidecar"))
+
+			Expect(k8sClient.Get(ctx, deploymentKey, svc)).To(Succeed())
+			Expect(svc.Annotations).To(HaveKeyWithValue("example.com/owner", "team-a"))
+			Expect(events()).To(ConsistOf(
+				"Normal Updated Updated Deployment "+podinfo.Name+"-be",
+				"Normal Updated Updated Deployment "+podinfo.Name+"-fe",
+			))
+		})
+
+		It("manages the fields with its own field manager", func() {
+			Expect(reconcile()).To(Succeed())
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+			var managers []string
+			for _, f := range deployment.ManagedFields {
+				managers = append(managers, f.Manager)
+			}
+			Expect(managers).To(ContainElement(FieldManager))
+		})
+	})
+
+	Context("requeue", func() {
+		BeforeEach(func() {
+			reconciler.ResyncInterval = time.Hour
+		})
+
+		It("re-examines the podinfo with a backoff until it's ready and then after the resync interval", func() {
+			result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(minRolloutBackoff))
+
+			By("backing off while the rollout takes longer")
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			ready := meta.FindStatusCondition(podinfo.Status.Conditions, v1beta1.ConditionReady)
+			ready.LastTransitionTime = metav1.NewTime(ready.LastTransitionTime.Add(-30 * time.Second))
+			Expect(k8sClient.Status().Update(ctx, podinfo)).To(Succeed())
+			result, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(40 * time.Second))
+
+			By("resyncing once the podinfo is ready")
+			markRolledOut("-be")
+			markRolledOut("-fe")
+			result, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(time.Hour))
+		})
+
+		It("caps the backoff", func() {
+			Expect(rolloutBackoff(0)).To(Equal(minRolloutBackoff))
+			Expect(rolloutBackoff(6 * time.Second)).To(Equal(10 * time.Second))
+			Expect(rolloutBackoff(24 * time.Hour)).To(Equal(maxRolloutBackoff))
+		})
+
+		It("stops retrying a spec the API server rejects and reports it as stalled", func() {
+			podinfo.Spec.Ingress = &v1beta1.IngressSpec{Host: "not_a_host"}
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(ctrl.Result{}))
+			Expect(events()).To(ContainElement(HavePrefix("Warning ReconcileFailed ")))
+
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(podinfo.Status.Conditions, v1beta1.ConditionStalled)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(podinfo.Status.Conditions, v1beta1.ConditionDegraded)).To(BeTrue())
+
+			By("fixing the spec")
+			podinfo.Spec.Ingress.Host = "podinfo.example.com"
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(podinfo.Status.Conditions, v1beta1.ConditionStalled)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(podinfo.Status.Conditions, v1beta1.ConditionDegraded)).To(BeTrue())
+		})
+
+		It("retries transient errors", func() {
+			foreign := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{GenerateName: "foreign-", Namespace: podinfo.Namespace},
+			}
+			Expect(k8sClient.Create(ctx, foreign)).To(Succeed())
+			deployment, err := utils.DefaultTemplates().PodinfoDeployment(podinfo, true, utils.PodinfoVersion)
+			Expect(err).NotTo(HaveOccurred())
+			deployment.OwnerReferences = []metav1.OwnerReference{
+				*metav1.NewControllerRef(foreign, corev1.SchemeGroupVersion.WithKind("ConfigMap")),
+			}
+			Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+			Expect(reconcile()).NotTo(Succeed())
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			stalled := meta.FindStatusCondition(podinfo.Status.Conditions, v1beta1.ConditionStalled)
+			Expect(stalled).NotTo(BeNil())
+			Expect(stalled.Status).To(Equal(metav1.ConditionFalse))
+			Expect(stalled.Reason).To(Equal("Retrying"))
+		})
+	})
+
+	Context("cancellation", func() {
+		It("aborts the reconciliation without reporting a failure", func() {
+			cancelled, cancel := context.WithCancel(ctx)
+			// cancel the reconciliation in the middle, once it starts applying the objects
+			reconciler.Client = &cancellingClient{Client: k8sClient, cancel: cancel}
+			_, err := reconciler.Reconcile(cancelled, ctrl.Request{NamespacedName: key})
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue(), "unexpected error: %v", err)
+			Expect(events()).To(BeEmpty())
+
+			fresh := &v1beta1.Podinfo{}
+			Expect(k8sClient.Get(ctx, key, fresh)).To(Succeed())
+			Expect(fresh.Status.Conditions).To(BeEmpty())
+			deployment := &appsv1.Deployment{}
+			err = k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, deployment)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+			By("reconciling again with a live context")
+			reconciler.Client = k8sClient
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-be", Namespace: podinfo.Namespace}, deployment)).To(Succeed())
+		})
+
+		It("gives up once the reconcile timeout expires", func() {
+			reconciler.ReconcileTimeout = time.Nanosecond
+			err := reconcile()
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue(), "unexpected error: %v", err)
+		})
+
+		It("keeps the finalizer when the cleanup is cancelled", func() {
+			Expect(reconcile()).To(Succeed())
+			Expect(k8sClient.Delete(ctx, podinfo)).To(Succeed())
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+			err := reconciler.Finalize(cancelled, podinfo, ctrl.Log)
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue(), "unexpected error: %v", err)
+			Expect(events()).NotTo(ContainElement(HavePrefix("Warning CleanupFailed ")))
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Finalizers).To(ContainElement(v1beta1.Finalizer))
+
+			By("finishing the cleanup with a live context")
+			Expect(reconcile()).To(Succeed())
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, key, podinfo))).To(BeTrue())
+		})
+	})
+
+	Context("deletion", func() {
+		objectsOf := func(podinfo *v1beta1.Podinfo) []client.Object {
+			var objs []client.Object
+			for _, suffix := range []string{"-be", "-fe"} {
+				meta := metav1.ObjectMeta{Name: podinfo.Name + suffix, Namespace: podinfo.Namespace}
+				objs = append(objs, &appsv1.Deployment{ObjectMeta: meta}, &corev1.Service{ObjectMeta: meta})
+			}
+			return objs
+		}
+
+		deletePodinfo := func() {
+			Expect(k8sClient.Get(ctx, key, podinfo)).To(Succeed())
+			Expect(podinfo.Finalizers).To(ContainElement(v1beta1.Finalizer))
+			Expect(k8sClient.Delete(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, key, podinfo))).To(BeTrue())
+		}
+
+		It("deletes the generated objects by default", func() {
+			Expect(reconcile()).To(Succeed())
+			deletePodinfo()
+
+			for _, obj := range objectsOf(podinfo) {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+				Expect(apierrors.IsNotFound(err)).To(BeTrue(), "%s should be deleted", obj.GetName())
+			}
+		})
+
+		It("tolerates objects that are already gone", func() {
+			Expect(reconcile()).To(Succeed())
+			svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}}
+			Expect(k8sClient.Delete(ctx, svc)).To(Succeed())
+			deletePodinfo()
+
+			deployment := &appsv1.Deployment{}
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}, deployment)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("keeps the generated objects with the Orphan policy", func() {
+			podinfo.Spec.DeletionPolicy = v1beta1.DeletionPolicyOrphan
+			Expect(k8sClient.Update(ctx, podinfo)).To(Succeed())
+			Expect(reconcile()).To(Succeed())
+			deletePodinfo()
+
+			for _, obj := range objectsOf(podinfo) {
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(obj), obj)).To(Succeed())
+				Expect(obj.GetOwnerReferences()).To(BeEmpty())
+			}
+		})
+	})
+})
+
+// cancellingClient cancels the context of the reconciliation on the first patch, before sending it
+type cancellingClient struct {
+	client.Client
+	cancel context.CancelFunc
+}
+
+func (c *cancellingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.cancel()
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
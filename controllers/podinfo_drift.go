@@ -0,0 +1,95 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServiceDrift compares the service found in the cluster with the desired one and returns the list
+// of fields that differ. Fields assigned by the cluster (e.g. clusterIP) are not taken into account.
+func ServiceDrift(found, desired *corev1.Service) []string {
+	var drifted []string
+	for k, v := range desired.Labels {
+		if found.Labels[k] != v {
+			drifted = append(drifted, "metadata.labels")
+			break
+		}
+	}
+	if metav1.GetControllerOf(found) == nil {
+		drifted = append(drifted, "metadata.ownerReferences")
+	}
+	if found.Spec.Type != desired.Spec.Type {
+		drifted = append(drifted, "spec.type")
+	}
+	if !reflect.DeepEqual(found.Spec.Selector, desired.Spec.Selector) {
+		drifted = append(drifted, "spec.selector")
+	}
+	if !equalPorts(found.Spec.Ports, desired.Spec.Ports) {
+		drifted = append(drifted, "spec.ports")
+	}
+	return drifted
+}
+
+// CorrectService brings the found service to the desired state while preserving the fields
+// assigned by the cluster
+func CorrectService(found, desired *corev1.Service) {
+	if found.Labels == nil {
+		found.Labels = map[string]string{}
+	}
+	for k, v := range desired.Labels {
+		found.Labels[k] = v
+	}
+	if metav1.GetControllerOf(found) == nil {
+		found.OwnerReferences = append(found.OwnerReferences, desired.OwnerReferences...)
+	}
+	if desired.Spec.Type == corev1.ServiceTypeClusterIP {
+		// these are allowed only for NodePort and LoadBalancer services
+		found.Spec.ExternalTrafficPolicy = ""
+		found.Spec.HealthCheckNodePort = 0
+	}
+	found.Spec.Type = desired.Spec.Type
+	found.Spec.Selector = desired.Spec.Selector
+	found.Spec.Ports = desired.Spec.Ports
+}
+
+func equalPorts(found, desired []corev1.ServicePort) bool {
+	if len(found) != len(desired) {
+		return false
+	}
+	for i := range desired {
+		f, d := found[i], desired[i]
+		if f.Name != d.Name || f.Port != d.Port || f.TargetPort != d.TargetPort || protocol(f) != protocol(d) {
+			return false
+		}
+		if d.NodePort != 0 && f.NodePort != d.NodePort {
+			return false
+		}
+	}
+	return true
+}
+
+// protocol returns the protocol of the port, defaulting to TCP the same way as the API server does
+func protocol(port corev1.ServicePort) corev1.Protocol {
+	if port.Protocol == "" {
+		return corev1.ProtocolTCP
+	}
+	return port.Protocol
+}
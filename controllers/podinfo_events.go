@@ -0,0 +1,168 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+)
+
+// Reasons of the events the operator emits on podinfoes.
+const (
+	// ReasonCreated is emitted when an object of the podinfo is created.
+	ReasonCreated = "Created"
+	// ReasonUpdated is emitted when an object of the podinfo is changed.
+	ReasonUpdated = "Updated"
+	// ReasonDeleted is emitted when an object no longer needed by the podinfo is removed.
+	ReasonDeleted = "Deleted"
+	// ReasonDriftCorrected is emitted when an object edited by someone else is put back to the desired state.
+	ReasonDriftCorrected = "DriftCorrected"
+	// ReasonUpgradeHeld is emitted while the frontend upgrade waits for the backend.
+	ReasonUpgradeHeld = "UpgradeHeld"
+	// ReasonMonitoringUnavailable is emitted when the monitoring is requested without Prometheus Operator's CRDs.
+	ReasonMonitoringUnavailable = "MonitoringUnavailable"
+	// ReasonFaultInjectionStarted is emitted when an active window of the fault injection starts.
+	ReasonFaultInjectionStarted = "FaultInjectionStarted"
+	// ReasonFaultInjectionStopped is emitted when an active window of the fault injection ends.
+	ReasonFaultInjectionStopped = "FaultInjectionStopped"
+	// ReasonReconcileFailed is emitted when the reconciliation of the podinfo fails.
+	ReasonReconcileFailed = "ReconcileFailed"
+	// ReasonCleanedUp is emitted when the objects of a deleted podinfo are deleted or orphaned.
+	ReasonCleanedUp = "CleanedUp"
+	// ReasonCleanupFailed is emitted when the objects of a deleted podinfo can't be cleaned up.
+	ReasonCleanupFailed = "CleanupFailed"
+)
+
+// EventDeduplicationWindow is how long a repeating event is suppressed after an identical event was emitted
+const EventDeduplicationWindow = 10 * time.Minute
+
+// repeating returns true for the events a reconcile emits again as long as the podinfo stays in the same
+// state, i.e. the warnings and the held upgrades. The other events record changes of the objects, each of
+// them is worth an event even if an identical one was emitted a moment ago.
+func repeating(eventtype, reason string) bool {
+	return eventtype == corev1.EventTypeWarning || reason == ReasonUpgradeHeld
+}
+
+// recordApplied emits a Created or Updated event for an applied object. existed says if the object existed
+// before the apply and found is the object from before the apply, the event is skipped when the apply didn't
+// change anything.
+func (r *PodinfoReconciler) recordApplied(podinfo *v1beta1.Podinfo, kind string, existed bool, found, applied client.Object) {
+	if !existed {
+		r.Recorder.Eventf(podinfo, corev1.EventTypeNormal, ReasonCreated, "Created %s %s", kind, applied.GetName())
+	} else if changed(found, applied) {
+		r.Recorder.Eventf(podinfo, corev1.EventTypeNormal, ReasonUpdated, "Updated %s %s", kind, applied.GetName())
+	}
+}
+
+// changed compares the objects without their status and the metadata maintained by the API server. The
+// resource version alone isn't enough, the API server bumps it when it refreshes the timestamps of the
+// managed fields even if the apply was a no-op.
+func changed(before, after client.Object) bool {
+	strip := func(obj client.Object) map[string]interface{} {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil
+		}
+		u := &unstructured.Unstructured{Object: content}
+		delete(u.Object, "apiVersion")
+		delete(u.Object, "kind")
+		delete(u.Object, "status")
+		u.SetResourceVersion("")
+		u.SetManagedFields(nil)
+		return u.Object
+	}
+	return !equality.Semantic.DeepEqual(strip(before), strip(after))
+}
+
+// dedupRecorder suppresses the repeating events identical to the ones emitted within the window, so that the
+// reconciles repeating the same failure or the same wait don't flood the podinfo with events
+type dedupRecorder struct {
+	record.EventRecorder
+	window time.Duration
+	now    func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewDedupRecorder returns an event recorder that passes the events to recorder, dropping the repeating
+// events identical to one (same object, type, reason and message) emitted within the window
+func NewDedupRecorder(recorder record.EventRecorder, window time.Duration) record.EventRecorder {
+	return &dedupRecorder{
+		EventRecorder: recorder,
+		window:        window,
+		now:           time.Now,
+		seen:          map[string]time.Time{},
+	}
+}
+
+func (d *dedupRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if d.duplicate(object, eventtype, reason, message) {
+		return
+	}
+	d.EventRecorder.Event(object, eventtype, reason, message)
+}
+
+func (d *dedupRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	d.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (d *dedupRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if d.duplicate(object, eventtype, reason, message) {
+		return
+	}
+	d.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+}
+
+// duplicate returns true if the event is repeating and the same event was emitted within the window,
+// otherwise it remembers the repeating event
+func (d *dedupRecorder) duplicate(object runtime.Object, eventtype, reason, message string) bool {
+	if !repeating(eventtype, reason) {
+		return false
+	}
+	id := ""
+	if accessor, err := meta.Accessor(object); err == nil {
+		id = string(accessor.GetUID()) + "/" + accessor.GetNamespace() + "/" + accessor.GetName()
+	}
+	key := id + "\x00" + eventtype + "\x00" + reason + "\x00" + message
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	for k, t := range d.seen {
+		if now.Sub(t) >= d.window {
+			delete(d.seen, k)
+		}
+	}
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+	d.seen[key] = now
+	return false
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+)
+
+var _ = Describe("Event deduplication", func() {
+	var (
+		fake     *record.FakeRecorder
+		recorder *dedupRecorder
+		now      time.Time
+		podinfo  *v1beta1.Podinfo
+	)
+
+	BeforeEach(func() {
+		fake = record.NewFakeRecorder(10)
+		recorder = NewDedupRecorder(fake, time.Minute).(*dedupRecorder)
+		now = time.Now()
+		recorder.now = func() time.Time { return now }
+		podinfo = &v1beta1.Podinfo{ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default", UID: "uid-1"}}
+	})
+
+	It("drops the repeated events within the window", func() {
+		recorder.Eventf(podinfo, corev1.EventTypeWarning, ReasonReconcileFailed, "boom %d", 1)
+		recorder.Eventf(podinfo, corev1.EventTypeWarning, ReasonReconcileFailed, "boom %d", 1)
+		Expect(fake.Events).To(HaveLen(1))
+
+		By("passing the events that differ")
+		recorder.Event(podinfo, corev1.EventTypeWarning, ReasonReconcileFailed, "boom 2")
+		other := podinfo.DeepCopy()
+		other.UID = "uid-2"
+		recorder.Event(other, corev1.EventTypeWarning, ReasonReconcileFailed, "boom 1")
+		Expect(fake.Events).To(HaveLen(3))
+	})
+
+	It("passes the events recording changes of the objects", func() {
+		recorder.Event(podinfo, corev1.EventTypeNormal, ReasonUpdated, "Updated Deployment podinfo-be")
+		recorder.Event(podinfo, corev1.EventTypeNormal, ReasonUpdated, "Updated Deployment podinfo-be")
+		Expect(fake.Events).To(HaveLen(2))
+		Expect(recorder.seen).To(BeEmpty())
+	})
+
+	It("passes the repeated event once the window is over", func() {
+		recorder.Event(podinfo, corev1.EventTypeNormal, ReasonUpgradeHeld, "holding")
+		now = now.Add(30 * time.Second)
+		recorder.Event(podinfo, corev1.EventTypeNormal, ReasonUpgradeHeld, "holding")
+		Expect(fake.Events).To(HaveLen(1))
+
+		now = now.Add(time.Minute)
+		recorder.Event(podinfo, corev1.EventTypeNormal, ReasonUpgradeHeld, "holding")
+		Expect(fake.Events).To(HaveLen(2))
+		Expect(recorder.seen).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,214 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+	"github.com/jkremser/podinfo-operator/controllers/utils"
+)
+
+// faultWindow is the state of the fault injection at a point of time
+type faultWindow struct {
+	// active is true if the point of time is in an active window
+	active bool
+	// start and end of the current or the last window, the start is zero when it isn't known (the last window
+	// of a cron schedule) and the end is zero for the faults that are active all the time
+	start, end time.Time
+	// next is the start of the next window, zero if there's none
+	next time.Time
+}
+
+// faultInjectionWindow returns the state of the fault injection at now. The windows of an interval are counted
+// from the creation of the podinfo, the cron schedule is evaluated in UTC unless it sets its time zone.
+func faultInjectionWindow(faults *v1beta1.FaultInjectionSpec, created, now time.Time) (faultWindow, error) {
+	var duration time.Duration
+	if faults.Duration != nil {
+		duration = faults.Duration.Duration
+	}
+	switch {
+	case faults.Schedule != "":
+		schedule, err := cron.ParseStandard(faults.Schedule)
+		if err != nil {
+			return faultWindow{}, fmt.Errorf("spec.faultInjection.schedule: %w", err)
+		}
+		now = now.UTC()
+		// the first window still active at now, if any
+		start := schedule.Next(now.Add(-duration))
+		if start.IsZero() || start.After(now) {
+			return faultWindow{next: start}, nil
+		}
+		// windows may overlap, the latest one started is the current one
+		for next := schedule.Next(start); !next.IsZero() && !next.After(now); next = schedule.Next(next) {
+			start = next
+		}
+		return faultWindow{active: true, start: start, end: start.Add(duration), next: schedule.Next(now)}, nil
+	case faults.Interval != nil:
+		interval := faults.Interval.Duration
+		if interval <= 0 {
+			return faultWindow{}, fmt.Errorf("spec.faultInjection.interval: must be greater than 0")
+		}
+		elapsed := now.Sub(created)
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		start := created.Add(elapsed / interval * interval)
+		end := start.Add(duration)
+		return faultWindow{active: now.Before(end), start: start, end: end, next: start.Add(interval)}, nil
+	default:
+		return faultWindow{active: true}, nil
+	}
+}
+
+// ReconcileFaultInjection records the state of the fault injection at now in the status of the podinfo and
+// emits an event when the faults are turned on or off. The deployments of the tiers are rendered with the
+// faults according to the recorded state.
+func (r *PodinfoReconciler) ReconcileFaultInjection(ctx context.Context, podinfo *v1beta1.Podinfo, now time.Time, log logr.Logger) error {
+	original := podinfo.DeepCopy()
+	previous := original.Status.FaultInjection
+	var status *v1beta1.FaultInjectionStatus
+	if faults := podinfo.Spec.FaultInjection; faults != nil {
+		window, err := faultInjectionWindow(faults, podinfo.CreationTimestamp.Time, now)
+		if err != nil {
+			log.Error(err, "Failed to evaluate the fault injection schedule")
+			return permanent(err)
+		}
+		status = faultInjectionStatus(previous, window, now)
+	}
+	if equality.Semantic.DeepEqual(previous, status) {
+		return nil
+	}
+	podinfo.Status.FaultInjection = status
+	if err := r.Status().Patch(ctx, podinfo, client.MergeFrom(original)); err != nil {
+		log.Error(err, "Failed to record the state of the fault injection")
+		return err
+	}
+
+	wasActive, active := previous != nil && previous.Active, status != nil && status.Active
+	tiers := faultInjectionTiers(podinfo.Spec.FaultInjection)
+	switch {
+	case active && !wasActive:
+		until := "until it's disabled"
+		if end := status.LastWindow.End; end != nil {
+			until = "until " + end.UTC().Format(time.RFC3339)
+		}
+		log.Info("Fault injection started", "tiers", tiers, "window", status.LastWindow)
+		r.Recorder.Eventf(podinfo, corev1.EventTypeNormal, ReasonFaultInjectionStarted,
+			"Injecting faults into the %s %s", tiers, until)
+	case wasActive && !active:
+		message := "Stopped injecting faults"
+		if status != nil && status.NextWindowStart != nil {
+			next := status.NextWindowStart
+			message += ", the next window starts at " + next.UTC().Format(time.RFC3339)
+		}
+		log.Info(message)
+		r.Recorder.Event(podinfo, corev1.EventTypeNormal, ReasonFaultInjectionStopped, message)
+	}
+	return nil
+}
+
+// faultInjectionStatus returns the status of the fault injection in the given window, the previous status
+// provides the last window when it isn't known from the schedule
+func faultInjectionStatus(previous *v1beta1.FaultInjectionStatus, window faultWindow, now time.Time) *v1beta1.FaultInjectionStatus {
+	status := &v1beta1.FaultInjectionStatus{Active: window.active}
+	if previous != nil {
+		status.LastWindow = previous.LastWindow.DeepCopy()
+	}
+	switch {
+	case !window.start.IsZero():
+		status.LastWindow = &v1beta1.FaultInjectionWindow{Start: statusTime(window.start)}
+		end := statusTime(window.end)
+		status.LastWindow.End = &end
+	case window.active && (previous == nil || !previous.Active || status.LastWindow == nil || status.LastWindow.End != nil):
+		// the faults are active all the time from now on
+		status.LastWindow = &v1beta1.FaultInjectionWindow{Start: statusTime(now)}
+	}
+	if !window.next.IsZero() {
+		next := statusTime(window.next)
+		status.NextWindowStart = &next
+	}
+	return status
+}
+
+// statusTime returns the time the way it's stored in the status, i.e. with second precision
+func statusTime(t time.Time) metav1.Time {
+	return metav1.NewTime(t.UTC().Truncate(time.Second))
+}
+
+// faultInjectionTiers returns the description of the tiers the faults are injected into used in the events
+func faultInjectionTiers(faults *v1beta1.FaultInjectionSpec) string {
+	switch {
+	case faults == nil:
+		return ""
+	case faults.Targets(true) && faults.Targets(false):
+		return "backend and frontend"
+	case faults.Targets(true):
+		return "backend"
+	default:
+		return "frontend"
+	}
+}
+
+// faultTransition returns when the recorded fault injection is turned on or off next, zero if it isn't scheduled
+func faultTransition(status *v1beta1.FaultInjectionStatus) time.Time {
+	switch {
+	case status == nil:
+		return time.Time{}
+	case status.Active && status.LastWindow != nil && status.LastWindow.End != nil:
+		return status.LastWindow.End.Time
+	case !status.Active && status.NextWindowStart != nil:
+		return status.NextWindowStart.Time
+	default:
+		return time.Time{}
+	}
+}
+
+// withFaults returns the podinfo the deployment of the tier is rendered from, i.e. with the faults merged into the
+// config of the tier while the fault injection into the tier is active
+func withFaults(podinfo *v1beta1.Podinfo, backend bool) *v1beta1.Podinfo {
+	faults, status := podinfo.Spec.FaultInjection, podinfo.Status.FaultInjection
+	if faults == nil || status == nil || !status.Active || !faults.Targets(backend) {
+		return podinfo
+	}
+	podinfo = podinfo.DeepCopy()
+	component := utils.Component(podinfo, backend)
+	if component.Config == nil {
+		component.Config = &v1beta1.PodinfoConfig{}
+	}
+	config := component.Config
+	if faults.RandomDelay != nil {
+		config.RandomDelay = faults.RandomDelay.DeepCopy()
+	}
+	config.RandomError = config.RandomError || faults.RandomError
+	if faults.StressCPU > 0 {
+		config.StressCPU = faults.StressCPU
+	}
+	if faults.StressMemory > 0 {
+		config.StressMemory = faults.StressMemory
+	}
+	return podinfo
+}
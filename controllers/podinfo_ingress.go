@@ -0,0 +1,58 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+	"github.com/jkremser/podinfo-operator/controllers/utils"
+)
+
+// ReconcileIngress creates or updates the ingress of the frontend when the podinfo asks for one, and
+// removes the ingress created earlier when spec.ingress is dropped
+func (r *PodinfoReconciler) ReconcileIngress(ctx context.Context, podinfo *v1beta1.Podinfo, log logr.Logger) error {
+	log = log.WithValues("tier", tierName(false))
+	key := client.ObjectKey{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}
+	var desired client.Object
+	if podinfo.Spec.Ingress != nil {
+		desired = utils.PodinfoIngress(podinfo)
+	}
+	return r.applyOptional(ctx, podinfo, "Ingress", key, &networkingv1.Ingress{}, desired, log)
+}
+
+// ingressURL returns the URL the frontend is exposed on, or empty string if there's no ingress
+// or its address isn't known yet
+func (r *PodinfoReconciler) ingressURL(ctx context.Context, podinfo *v1beta1.Podinfo) (string, error) {
+	if podinfo.Spec.Ingress == nil {
+		return "", nil
+	}
+	ingress := &networkingv1.Ingress{}
+	err := r.Get(ctx, client.ObjectKey{Name: podinfo.Name + "-fe", Namespace: podinfo.Namespace}, ingress)
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return utils.IngressURL(podinfo, ingress), nil
+}
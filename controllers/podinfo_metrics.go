@@ -0,0 +1,149 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+)
+
+// Reasons of the reconcile outcomes counted by the podinfo_reconcile_total metric.
+const (
+	OutcomeReconciled           = "Reconciled"
+	OutcomeFinalized            = "Finalized"
+	OutcomeGetFailed            = "GetFailed"
+	OutcomeFinalizerFailed      = "FinalizerFailed"
+	OutcomeFinalizeFailed       = "FinalizeFailed"
+	OutcomeFaultInjectionFailed = "FaultInjectionFailed"
+	OutcomeCacheFailed          = "CacheFailed"
+	OutcomeBackendFailed        = "BackendFailed"
+	OutcomeFrontendFailed       = "FrontendFailed"
+	OutcomeIngressFailed        = "IngressFailed"
+	OutcomeMonitoringFailed     = "MonitoringFailed"
+	OutcomeStatusUpdateFailed   = "StatusUpdateFailed"
+)
+
+var (
+	managedInstances = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "podinfo_managed_instances",
+		Help: "Number of podinfoes managed by the operator.",
+	})
+	tierDesiredReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "podinfo_tier_desired_replicas",
+		Help: "Desired number of replicas of a podinfo tier.",
+	}, []string{"namespace", "name", "tier"})
+	tierReadyReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "podinfo_tier_ready_replicas",
+		Help: "Number of ready replicas of a podinfo tier.",
+	}, []string{"namespace", "name", "tier"})
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podinfo_reconcile_total",
+		Help: "Number of podinfo reconciliations by result (success or error) and reason.",
+	}, []string{"result", "reason"})
+	driftCorrectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podinfo_drift_corrections_total",
+		Help: "Number of objects put back to the desired state after they were edited by someone else.",
+	}, []string{"kind"})
+	timeToReady = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "podinfo_time_to_ready_seconds",
+		Help:    "Time it takes a podinfo to become ready after it's created or stops being ready.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	// instances are the podinfoes counted by managedInstances
+	instances = map[types.NamespacedName]struct{}{}
+	// instancesMu guards instances
+	instancesMu sync.Mutex
+)
+
+// tiers are the values of the tier label
+var tiers = []string{"frontend", "backend", "cache"}
+
+func init() {
+	metrics.Registry.MustRegister(managedInstances, tierDesiredReplicas, tierReadyReplicas, reconcileTotal,
+		driftCorrectionsTotal, timeToReady)
+}
+
+// observeReconcile counts the outcome of a reconciliation, reason is one of the Outcome* constants
+func observeReconcile(reason string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	reconcileTotal.WithLabelValues(result, reason).Inc()
+}
+
+// observeDriftCorrection counts a corrected object of the given kind
+func observeDriftCorrection(kind string) {
+	driftCorrectionsTotal.WithLabelValues(kind).Inc()
+}
+
+// observeInstance records the podinfo as managed and exports the replicas of its tiers from its status
+func observeInstance(podinfo *v1beta1.Podinfo) {
+	key := types.NamespacedName{Name: podinfo.Name, Namespace: podinfo.Namespace}
+	instancesMu.Lock()
+	instances[key] = struct{}{}
+	managedInstances.Set(float64(len(instances)))
+	instancesMu.Unlock()
+
+	observeTier(key, tierName(false), &podinfo.Status.Frontend)
+	observeTier(key, tierName(true), &podinfo.Status.Backend)
+	observeTier(key, "cache", podinfo.Status.Cache)
+}
+
+// observeTier exports the replicas of the tier, the series of a missing (nil) tier are removed
+func observeTier(key types.NamespacedName, tier string, status *v1beta1.TierStatus) {
+	if status == nil {
+		tierDesiredReplicas.DeleteLabelValues(key.Namespace, key.Name, tier)
+		tierReadyReplicas.DeleteLabelValues(key.Namespace, key.Name, tier)
+		return
+	}
+	tierDesiredReplicas.WithLabelValues(key.Namespace, key.Name, tier).Set(float64(status.Replicas))
+	tierReadyReplicas.WithLabelValues(key.Namespace, key.Name, tier).Set(float64(status.ReadyReplicas))
+}
+
+// forgetInstance removes the podinfo from the managed ones together with the series of its tiers
+func forgetInstance(key types.NamespacedName) {
+	instancesMu.Lock()
+	delete(instances, key)
+	managedInstances.Set(float64(len(instances)))
+	instancesMu.Unlock()
+
+	for _, tier := range tiers {
+		observeTier(key, tier, nil)
+	}
+}
+
+// observeReadiness records the time to ready when the Ready condition turns true. The time is measured
+// from the creation of the podinfo, or from the moment it stopped being ready.
+func observeReadiness(podinfo *v1beta1.Podinfo, previous *metav1.Condition, ready metav1.Condition, now time.Time) {
+	if ready.Status != metav1.ConditionTrue || (previous != nil && previous.Status == metav1.ConditionTrue) {
+		return
+	}
+	since := podinfo.CreationTimestamp.Time
+	if previous != nil && !previous.LastTransitionTime.IsZero() {
+		since = previous.LastTransitionTime.Time
+	}
+	timeToReady.Observe(now.Sub(since).Seconds())
+}
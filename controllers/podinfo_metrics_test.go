@@ -0,0 +1,110 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+)
+
+var _ = Describe("Metrics", func() {
+	var podinfo *v1beta1.Podinfo
+
+	BeforeEach(func() {
+		podinfo = &v1beta1.Podinfo{
+			ObjectMeta: metav1.ObjectMeta{Name: "metrics", Namespace: "metrics-ns"},
+			Status: v1beta1.PodinfoStatus{
+				Frontend: v1beta1.TierStatus{Replicas: 2, ReadyReplicas: 1},
+				Backend:  v1beta1.TierStatus{Replicas: 3, ReadyReplicas: 3},
+			},
+		}
+	})
+
+	It("exports the managed instances and the replicas of their tiers", func() {
+		key := types.NamespacedName{Name: podinfo.Name, Namespace: podinfo.Namespace}
+		managed := testutil.ToFloat64(managedInstances)
+		observeInstance(podinfo)
+		observeInstance(podinfo)
+		Expect(testutil.ToFloat64(managedInstances)).To(Equal(managed + 1))
+		Expect(testutil.ToFloat64(tierDesiredReplicas.WithLabelValues("metrics-ns", "metrics", "frontend"))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(tierReadyReplicas.WithLabelValues("metrics-ns", "metrics", "frontend"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(tierDesiredReplicas.WithLabelValues("metrics-ns", "metrics", "backend"))).To(Equal(3.0))
+		Expect(tierDesiredReplicas.DeleteLabelValues("metrics-ns", "metrics", "cache")).To(BeFalse())
+
+		By("adding the cache")
+		podinfo.Status.Cache = &v1beta1.TierStatus{Replicas: 1}
+		observeInstance(podinfo)
+		Expect(testutil.ToFloat64(tierReadyReplicas.WithLabelValues("metrics-ns", "metrics", "cache"))).To(Equal(0.0))
+
+		By("forgetting the instance")
+		forgetInstance(key)
+		Expect(testutil.ToFloat64(managedInstances)).To(Equal(managed))
+		for _, tier := range tiers {
+			Expect(tierDesiredReplicas.DeleteLabelValues("metrics-ns", "metrics", tier)).To(BeFalse())
+			Expect(tierReadyReplicas.DeleteLabelValues("metrics-ns", "metrics", tier)).To(BeFalse())
+		}
+	})
+
+	It("counts the reconcile outcomes and drift corrections", func() {
+		reconciled := testutil.ToFloat64(reconcileTotal.WithLabelValues("success", OutcomeReconciled))
+		failed := testutil.ToFloat64(reconcileTotal.WithLabelValues("error", OutcomeBackendFailed))
+		drifts := testutil.ToFloat64(driftCorrectionsTotal.WithLabelValues("Service"))
+
+		observeReconcile(OutcomeReconciled, nil)
+		observeReconcile(OutcomeBackendFailed, errors.New("boom"))
+		observeReconcile(OutcomeBackendFailed, errors.New("boom"))
+		observeDriftCorrection("Service")
+
+		Expect(testutil.ToFloat64(reconcileTotal.WithLabelValues("success", OutcomeReconciled))).To(Equal(reconciled + 1))
+		Expect(testutil.ToFloat64(reconcileTotal.WithLabelValues("error", OutcomeBackendFailed))).To(Equal(failed + 2))
+		Expect(testutil.ToFloat64(driftCorrectionsTotal.WithLabelValues("Service"))).To(Equal(drifts + 1))
+	})
+
+	It("observes the time to ready only when the podinfo becomes ready", func() {
+		now := time.Now()
+		podinfo.CreationTimestamp = metav1.NewTime(now.Add(-30 * time.Second))
+		notReady := metav1.Condition{Type: v1beta1.ConditionReady, Status: metav1.ConditionFalse, LastTransitionTime: metav1.NewTime(now.Add(-10 * time.Second))}
+		ready := metav1.Condition{Type: v1beta1.ConditionReady, Status: metav1.ConditionTrue}
+		// sum returns the sum of the observed times
+		sum := func() float64 {
+			metric := &dto.Metric{}
+			Expect(timeToReady.Write(metric)).To(Succeed())
+			return metric.GetHistogram().GetSampleSum()
+		}
+		before := sum()
+		observeReadiness(podinfo, nil, ready, now)
+		Expect(sum() - before).To(BeNumerically("~", 30, 0.001))
+
+		before = sum()
+		observeReadiness(podinfo, &notReady, ready, now)
+		Expect(sum() - before).To(BeNumerically("~", 10, 0.001))
+
+		before = sum()
+		observeReadiness(podinfo, &ready, ready, now)
+		observeReadiness(podinfo, &notReady, notReady, now)
+		Expect(sum()).To(Equal(before))
+	})
+})
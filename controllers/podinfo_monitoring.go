@@ -0,0 +1,78 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+	"github.com/jkremser/podinfo-operator/controllers/utils"
+)
+
+// ReconcileMonitoring creates, updates or removes the ServiceMonitor and the PrometheusRule of the podinfo.
+// The monitoring.coreos.com CRDs are optional, without them the monitoring is skipped and reported by an event.
+func (r *PodinfoReconciler) ReconcileMonitoring(ctx context.Context, podinfo *v1beta1.Podinfo, log logr.Logger) error {
+	key := client.ObjectKey{Name: podinfo.Name, Namespace: podinfo.Namespace}
+	var monitor, rule client.Object
+	if monitoring := podinfo.Spec.Monitoring; monitoring != nil {
+		monitor = utils.PodinfoServiceMonitor(podinfo)
+		if monitoring.Alerts != nil {
+			rule = utils.PodinfoPrometheusRule(podinfo)
+		}
+	}
+
+	for _, o := range []struct {
+		gvk     schema.GroupVersionKind
+		desired client.Object
+	}{{utils.ServiceMonitorGVK, monitor}, {utils.PrometheusRuleGVK, rule}} {
+		available, err := r.kindAvailable(o.gvk)
+		if err != nil {
+			log.Error(err, "Failed to discover "+o.gvk.Kind)
+			return err
+		}
+		if !available {
+			if o.desired != nil {
+				log.Info("Skipping the monitoring, the CRD is not installed", "kind", o.gvk.Kind)
+				r.Recorder.Eventf(podinfo, corev1.EventTypeWarning, ReasonMonitoringUnavailable,
+					"%s can't be created, the %s CRDs are not installed", o.gvk.Kind, o.gvk.Group)
+			}
+			continue
+		}
+		found := &unstructured.Unstructured{}
+		found.SetGroupVersionKind(o.gvk)
+		if err := r.applyOptional(ctx, podinfo, o.gvk.Kind, key, found, o.desired, log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kindAvailable returns true if the API server serves the kind
+func (r *PodinfoReconciler) kindAvailable(gvk schema.GroupVersionKind) (bool, error) {
+	_, err := r.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+	"github.com/jkremser/podinfo-operator/controllers/utils"
+)
+
+// ReconcileNetworkPolicy creates or updates the network policy of a tier when the network policies are
+// enabled, and removes the policy created earlier when they're disabled
+func (r *PodinfoReconciler) ReconcileNetworkPolicy(ctx context.Context, podinfo *v1beta1.Podinfo, backend bool, log logr.Logger) error {
+	imgSuffix := "-fe"
+	if backend {
+		imgSuffix = "-be"
+	}
+	key := client.ObjectKey{Name: podinfo.Name + imgSuffix, Namespace: podinfo.Namespace}
+	var desired client.Object
+	if podinfo.Spec.NetworkPolicy != nil && podinfo.Spec.NetworkPolicy.Enabled {
+		desired = utils.PodinfoNetworkPolicy(podinfo, backend)
+	}
+	return r.applyOptional(ctx, podinfo, "NetworkPolicy", key, &networkingv1.NetworkPolicy{}, desired, log)
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+	"github.com/jkremser/podinfo-operator/controllers/utils"
+)
+
+// ReconcilePodDisruptionBudget creates or updates the pod disruption budget of a tier, and removes
+// the budget created earlier when it's dropped from the spec of the tier
+func (r *PodinfoReconciler) ReconcilePodDisruptionBudget(ctx context.Context, podinfo *v1beta1.Podinfo, backend bool, log logr.Logger) error {
+	imgSuffix := "-fe"
+	if backend {
+		imgSuffix = "-be"
+	}
+	key := client.ObjectKey{Name: podinfo.Name + imgSuffix, Namespace: podinfo.Namespace}
+	var desired client.Object
+	if utils.Component(podinfo, backend).PodDisruptionBudget != nil {
+		desired = utils.PodinfoPodDisruptionBudget(podinfo, backend)
+	}
+	return r.applyOptional(ctx, podinfo, "PodDisruptionBudget", key, &policyv1beta1.PodDisruptionBudget{}, desired, log)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+)
+
+const (
+	// minRolloutBackoff is the delay of the first re-examination of a podinfo that isn't ready
+	minRolloutBackoff = 5 * time.Second
+	// maxRolloutBackoff caps the delay between the re-examinations of a podinfo that isn't ready
+	maxRolloutBackoff = 5 * time.Minute
+)
+
+// DefaultResyncInterval is the default interval of re-examining podinfoes that are ready
+const DefaultResyncInterval = 10 * time.Minute
+
+// requeue returns the result of a successful reconciliation. A podinfo that isn't ready (e.g. while the
+// deployments are rolling out) is re-examined with an exponential backoff, a ready one after the resync interval.
+// Podinfoes with scheduled fault injection are re-examined at the latest when the faults are turned on or off.
+func (r *PodinfoReconciler) requeue(podinfo *v1beta1.Podinfo, now time.Time) ctrl.Result {
+	result := ctrl.Result{RequeueAfter: r.ResyncInterval}
+	if !meta.IsStatusConditionTrue(podinfo.Status.Conditions, v1beta1.ConditionReady) {
+		var unready time.Duration
+		if ready := meta.FindStatusCondition(podinfo.Status.Conditions, v1beta1.ConditionReady); ready != nil {
+			unready = now.Sub(ready.LastTransitionTime.Time)
+		}
+		result.RequeueAfter = rolloutBackoff(unready)
+	}
+	// the fault injection is turned on or off on time regardless of the readiness
+	if transition := faultTransition(podinfo.Status.FaultInjection); !transition.IsZero() {
+		delay := transition.Sub(now)
+		if delay < time.Second {
+			delay = time.Second
+		}
+		if result.RequeueAfter == 0 || delay < result.RequeueAfter {
+			result.RequeueAfter = delay
+		}
+	}
+	return result
+}
+
+// rolloutBackoff returns the delay before the next re-examination of a podinfo that isn't ready for the given
+// duration, the delay doubles from minRolloutBackoff until it reaches the duration or maxRolloutBackoff
+func rolloutBackoff(unready time.Duration) time.Duration {
+	delay := minRolloutBackoff
+	for delay < unready && delay < maxRolloutBackoff {
+		delay *= 2
+	}
+	if delay > maxRolloutBackoff {
+		return maxRolloutBackoff
+	}
+	return delay
+}
+
+// permanentError marks an error retrying doesn't fix
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// permanent marks the error as one retrying doesn't fix, e.g. a template that can't be rendered for the podinfo
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+// isPermanent returns true for the errors retrying doesn't fix, i.e. the errors marked as permanent and the
+// API server rejecting the objects generated from the spec of the podinfo. Everything else (conflicts, timeouts,
+// unavailable API server, ...) is transient.
+func isPermanent(err error) bool {
+	if errors.As(err, &permanentError{}) {
+		return true
+	}
+	return apierrors.IsInvalid(err) || apierrors.IsBadRequest(err)
+}
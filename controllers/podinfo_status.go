@@ -0,0 +1,241 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+	"github.com/jkremser/podinfo-operator/controllers/utils"
+)
+
+// UpdateStatus observes the -be, -fe and -cache deployments and writes the per-tier readiness,
+// the observed generation and the Ready/Progressing/Degraded/Stalled conditions into the status
+// subresource of the podinfo. reconcileErr is the error (if any) the reconciliation ended with.
+func (r *PodinfoReconciler) UpdateStatus(ctx context.Context, podinfo *v1beta1.Podinfo, reconcileErr error) error {
+	original := podinfo.DeepCopy()
+
+	backend, backendDeployment, err := r.tierStatus(ctx, podinfo, true)
+	if err != nil {
+		return err
+	}
+	frontend, frontendDeployment, err := r.tierStatus(ctx, podinfo, false)
+	if err != nil {
+		return err
+	}
+	cache, cacheDeployment, err := r.cacheStatus(ctx, podinfo)
+	if err != nil {
+		return err
+	}
+	url, err := r.ingressURL(ctx, podinfo)
+	if err != nil {
+		return err
+	}
+	podinfo.Status.Backend = backend
+	podinfo.Status.Frontend = frontend
+	podinfo.Status.Cache = cache
+	podinfo.Status.URL = url
+	podinfo.Status.ObservedGeneration = podinfo.Generation
+
+	// Degraded
+	degraded := metav1.Condition{
+		Type:               v1beta1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             "ReconcileSucceeded",
+		ObservedGeneration: podinfo.Generation,
+	}
+	if reconcileErr != nil {
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = "ReconcileFailed"
+		degraded.Message = reconcileErr.Error()
+	} else if msg := rolloutFailure(backendDeployment, frontendDeployment, cacheDeployment); msg != "" {
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = "RolloutFailed"
+		degraded.Message = msg
+	}
+	meta.SetStatusCondition(&podinfo.Status.Conditions, degraded)
+
+	// Stalled
+	stalled := metav1.Condition{
+		Type:               v1beta1.ConditionStalled,
+		Status:             metav1.ConditionFalse,
+		Reason:             "ReconcileSucceeded",
+		ObservedGeneration: podinfo.Generation,
+	}
+	if isPermanent(reconcileErr) {
+		stalled.Status = metav1.ConditionTrue
+		stalled.Reason = "InvalidSpec"
+		stalled.Message = reconcileErr.Error()
+	} else if reconcileErr != nil {
+		stalled.Reason = "Retrying"
+	}
+	meta.SetStatusCondition(&podinfo.Status.Conditions, stalled)
+
+	// Progressing
+	progressing := metav1.Condition{
+		Type:               v1beta1.ConditionProgressing,
+		Status:             metav1.ConditionFalse,
+		Reason:             "RolloutComplete",
+		ObservedGeneration: podinfo.Generation,
+	}
+	readiness := fmt.Sprintf("backend %s, frontend %s", backend.Ready, frontend.Ready)
+	if cache != nil {
+		readiness += ", cache " + cache.Ready
+	}
+	if rollingOut(backendDeployment) || rollingOut(frontendDeployment) || (cache != nil && rollingOut(cacheDeployment)) {
+		progressing.Status = metav1.ConditionTrue
+		progressing.Reason = "RollingOut"
+		progressing.Message = readiness
+	}
+	meta.SetStatusCondition(&podinfo.Status.Conditions, progressing)
+
+	// Ready
+	ready := metav1.Condition{
+		Type:               v1beta1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             "ReplicasNotReady",
+		Message:            readiness,
+		ObservedGeneration: podinfo.Generation,
+	}
+	if backendDeployment != nil && frontendDeployment != nil &&
+		backend.ReadyReplicas >= backend.Replicas && frontend.ReadyReplicas >= frontend.Replicas &&
+		(cache == nil || (cacheDeployment != nil && cache.ReadyReplicas >= cache.Replicas)) {
+		ready.Status = metav1.ConditionTrue
+		ready.Reason = "AllReplicasReady"
+	}
+	observeReadiness(podinfo, meta.FindStatusCondition(original.Status.Conditions, v1beta1.ConditionReady), ready, time.Now())
+	meta.SetStatusCondition(&podinfo.Status.Conditions, ready)
+	observeInstance(podinfo)
+
+	return r.Status().Patch(ctx, podinfo, client.MergeFrom(original))
+}
+
+// tierStatus returns the observed state of the tier together with its deployment,
+// the deployment is nil if it doesn't exist (yet)
+func (r *PodinfoReconciler) tierStatus(ctx context.Context, podinfo *v1beta1.Podinfo, backend bool) (v1beta1.TierStatus, *appsv1.Deployment, error) {
+	imgSuffix := "-fe"
+	if backend {
+		imgSuffix = "-be"
+	}
+	desired := utils.Component(podinfo, backend).ReplicaCount()
+	previous := podinfo.Status.Frontend
+	if backend {
+		previous = podinfo.Status.Backend
+	}
+	status := v1beta1.TierStatus{
+		Replicas: desired,
+		Version:  previous.Version,
+	}
+
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      podinfo.Name + imgSuffix,
+		Namespace: podinfo.Namespace,
+	}, deployment)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return status, nil, err
+		}
+		deployment = nil
+	} else {
+		status.ReadyReplicas = deployment.Status.ReadyReplicas
+		if utils.Component(podinfo, backend).Autoscaling != nil {
+			// the autoscaler decides
+			status.Replicas = desiredReplicas(deployment)
+		}
+		if !rollingOut(deployment) {
+			status.Version = deployment.Spec.Template.Labels[utils.VersionLabel]
+		}
+	}
+	status.Ready = fmt.Sprintf("%d/%d", status.ReadyReplicas, status.Replicas)
+	return status, deployment, nil
+}
+
+// cacheStatus returns the observed state of the cache tier together with its deployment, both are nil
+// when the cache isn't enabled, the deployment is nil if it doesn't exist (yet)
+func (r *PodinfoReconciler) cacheStatus(ctx context.Context, podinfo *v1beta1.Podinfo) (*v1beta1.TierStatus, *appsv1.Deployment, error) {
+	if podinfo.Spec.Cache == nil {
+		return nil, nil, nil
+	}
+	status := &v1beta1.TierStatus{Replicas: 1}
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      podinfo.Name + "-cache",
+		Namespace: podinfo.Namespace,
+	}, deployment)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return status, nil, err
+		}
+		deployment = nil
+	} else {
+		status.Replicas = desiredReplicas(deployment)
+		status.ReadyReplicas = deployment.Status.ReadyReplicas
+	}
+	status.Ready = fmt.Sprintf("%d/%d", status.ReadyReplicas, status.Replicas)
+	return status, deployment, nil
+}
+
+// rollingOut returns true if the deployment controller hasn't yet caught up with the
+// latest spec of the deployment or if not all the replicas are updated and ready
+func rollingOut(deployment *appsv1.Deployment) bool {
+	if deployment == nil {
+		return true
+	}
+	desired := desiredReplicas(deployment)
+	return deployment.Status.ObservedGeneration < deployment.Generation ||
+		deployment.Status.UpdatedReplicas < desired ||
+		deployment.Status.ReadyReplicas < desired
+}
+
+// desiredReplicas returns the number of replicas of the deployment, taking the default into account
+func desiredReplicas(deployment *appsv1.Deployment) int32 {
+	if deployment.Spec.Replicas == nil {
+		return 1
+	}
+	return *deployment.Spec.Replicas
+}
+
+// rolloutFailure returns the message of the first failed deployment condition, or empty
+// string if none of the deployments reports a failure
+func rolloutFailure(deployments ...*appsv1.Deployment) string {
+	for _, d := range deployments {
+		if d == nil {
+			continue
+		}
+		for _, c := range d.Status.Conditions {
+			if c.Type == appsv1.DeploymentReplicaFailure && c.Status == corev1.ConditionTrue {
+				return d.Name + ": " + c.Message
+			}
+			if c.Type == appsv1.DeploymentProgressing && c.Status == corev1.ConditionFalse &&
+				c.Reason == "ProgressDeadlineExceeded" {
+				return d.Name + ": " + c.Message
+			}
+		}
+	}
+	return ""
+}
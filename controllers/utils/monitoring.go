@@ -0,0 +1,146 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+)
+
+// The kinds of Prometheus Operator, they're handled as unstructured objects as the CRDs may be missing in the cluster.
+var (
+	ServiceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+	PrometheusRuleGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PrometheusRule"}
+)
+
+// Defaults of the alerting rules
+const (
+	DefaultErrorRatePercent = 5
+	DefaultLatencyThreshold = 500 * time.Millisecond
+	DefaultAlertFor         = 5 * time.Minute
+)
+
+// PodinfoServiceMonitor returns the service monitor scraping the http-metrics port of the frontend and the backend
+// services, podinfo.Spec.Monitoring must not be nil
+func PodinfoServiceMonitor(podinfo *v1beta1.Podinfo) *unstructured.Unstructured {
+	endpoint := map[string]interface{}{
+		"port": "http-metrics",
+		"path": "/metrics",
+	}
+	if interval := podinfo.Spec.Monitoring.Interval; interval != "" {
+		endpoint["interval"] = interval
+	}
+	spec := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchExpressions": []interface{}{
+				map[string]interface{}{
+					"key":      "app",
+					"operator": string(metav1.LabelSelectorOpIn),
+					"values":   []interface{}{podinfo.Name + "-fe", podinfo.Name + "-be"},
+				},
+			},
+		},
+		"namespaceSelector": map[string]interface{}{
+			"matchNames": []interface{}{podinfo.Namespace},
+		},
+		"endpoints": []interface{}{endpoint},
+	}
+	return monitoringObject(podinfo, ServiceMonitorGVK, spec)
+}
+
+// PodinfoPrometheusRule returns the rule alerting on the error rate and the latency of the frontend and the
+// backend, podinfo.Spec.Monitoring.Alerts must not be nil
+func PodinfoPrometheusRule(podinfo *v1beta1.Podinfo) *unstructured.Unstructured {
+	alerts := podinfo.Spec.Monitoring.Alerts
+	errorRate := int64(DefaultErrorRatePercent)
+	if alerts.ErrorRatePercent != nil {
+		errorRate = int64(*alerts.ErrorRatePercent)
+	}
+	latency := DefaultLatencyThreshold
+	if alerts.LatencyThreshold != nil {
+		latency = alerts.LatencyThreshold.Duration
+	}
+	forDuration := DefaultAlertFor
+	if alerts.For != nil {
+		forDuration = alerts.For.Duration
+	}
+
+	selector := fmt.Sprintf(`namespace=%q,service=~"%s-(fe|be)"`, podinfo.Namespace, podinfo.Name)
+	labels := map[string]interface{}{"severity": "warning"}
+	rules := []interface{}{
+		map[string]interface{}{
+			"alert": "PodinfoHighErrorRate",
+			"expr": fmt.Sprintf(`100 * sum by (service) (rate(http_requests_total{%s,status=~"5.."}[5m]))`+
+				` / sum by (service) (rate(http_requests_total{%s}[5m])) > %d`, selector, selector, errorRate),
+			"for":    promDuration(forDuration),
+			"labels": labels,
+			"annotations": map[string]interface{}{
+				"summary": fmt.Sprintf("More than %d%% of the requests to {{ $labels.service }} fail", errorRate),
+			},
+		},
+		map[string]interface{}{
+			"alert": "PodinfoHighLatency",
+			"expr": fmt.Sprintf(`histogram_quantile(0.99, sum by (service, le) (rate(http_request_duration_seconds_bucket{%s}[5m]))) > %g`,
+				selector, latency.Seconds()),
+			"for":    promDuration(forDuration),
+			"labels": labels,
+			"annotations": map[string]interface{}{
+				"summary": fmt.Sprintf("The 99th percentile latency of {{ $labels.service }} is above %s", latency),
+			},
+		},
+	}
+	spec := map[string]interface{}{
+		"groups": []interface{}{
+			map[string]interface{}{
+				"name":  podinfo.Namespace + "-" + podinfo.Name + ".rules",
+				"rules": rules,
+			},
+		},
+	}
+	return monitoringObject(podinfo, PrometheusRuleGVK, spec)
+}
+
+// monitoringObject returns the Prometheus Operator object of the kind with the spec, named after the podinfo
+func monitoringObject(podinfo *v1beta1.Podinfo, gvk schema.GroupVersionKind, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetName(podinfo.Name)
+	obj.SetNamespace(podinfo.Namespace)
+	labels := map[string]string{}
+	for k, v := range podinfo.Spec.Monitoring.Labels {
+		labels[k] = v
+	}
+	labels["app.kubernetes.io/instance"] = podinfo.Name
+	labels[ManagedByLabel] = ManagedBy
+	obj.SetLabels(labels)
+	obj.SetOwnerReferences(OwnerReferences(podinfo))
+	return obj
+}
+
+// promDuration formats the duration the way Prometheus parses it
+func promDuration(d time.Duration) string {
+	if d%time.Second != 0 {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%ds", int64(d.Seconds()))
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/yaml"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+)
+
+// applyPatches applies the patches of the tier targeting the given kind in order to obj and decodes the result
+// into patched, which must be an empty object of the same type. path is the path of the patches in the podinfo
+// used in the errors.
+func applyPatches(path string, obj interface{}, target v1beta1.PatchTarget, patches []v1beta1.Patch, patched interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	for i := range patches {
+		if patches[i].Target != target {
+			continue
+		}
+		patch, jsonPatch, err := patches[i].Decode()
+		if err == nil {
+			if jsonPatch {
+				data, err = applyJSONPatch(data, patch)
+			} else {
+				data, err = strategicpatch.StrategicMergePatch(data, patch, patched)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s[%d]: unable to patch the %s: %w", path, i, target, err)
+		}
+	}
+	if err := yaml.UnmarshalStrict(data, patched); err != nil {
+		return fmt.Errorf("%s: the patched %s is invalid: %w", path, target, err)
+	}
+	return nil
+}
+
+// applyJSONPatch applies the RFC 6902 JSON patch to the document
+func applyJSONPatch(doc, patch []byte) ([]byte, error) {
+	decoded, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	return decoded.Apply(doc)
+}
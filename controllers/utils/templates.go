@@ -0,0 +1,348 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
+)
+
+const (
+	// DeploymentTemplate is the name of the template of the tier deployments
+	DeploymentTemplate = "deployment.yaml"
+	// ServiceTemplate is the name of the template of the tier services
+	ServiceTemplate = "service.yaml"
+)
+
+//go:embed templates/*.yaml
+var defaultTemplateFiles embed.FS
+
+var defaultTemplates *Templates
+
+func init() {
+	templates, err := NewTemplates(nil)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded templates: %v", err))
+	}
+	defaultTemplates = templates
+}
+
+// TemplateData is the input the templates are rendered with
+type TemplateData struct {
+	// Podinfo is the podinfo the objects are rendered for.
+	Podinfo *v1beta1.Podinfo
+	// Name of the rendered object, e.g. podinfo-sample-fe.
+	Name string
+	// Backend is true when rendering the backend tier.
+	Backend bool
+	// Version is the podinfo version the tier runs, it's only set for the deployment.
+	Version string
+	// Image is the podinfo image of the version, it's only set for the deployment.
+	Image string
+	// Level is the log level of podinfo.
+	Level string
+	// Ports are the ports of the podinfo servers of the tier.
+	Ports TemplatePorts
+}
+
+// TemplatePorts are the ports of the podinfo servers, taken from the config of the tiers
+type TemplatePorts struct {
+	// HTTP is the port of the HTTP server.
+	HTTP int32
+	// Metrics is the port of the metrics server.
+	Metrics int32
+	// GRPC is the port of the gRPC server.
+	GRPC int32
+	// BackendHTTP is the port of the HTTP server of the backend, the frontend calls the backend on it.
+	BackendHTTP int32
+}
+
+// Templates renders the deployments and services of the podinfo tiers from YAML manifests in the
+// text/template format
+type Templates struct {
+	templates map[string]*template.Template
+}
+
+// DefaultTemplates returns the templates embedded into the operator
+func DefaultTemplates() *Templates {
+	return defaultTemplates
+}
+
+// NewTemplates parses the templates overriding the embedded ones, the overrides are keyed by the template
+// name (DeploymentTemplate or ServiceTemplate). The templates are test rendered for both tiers of a sample
+// podinfo, so that a broken template is refused before it's used for the real podinfoes.
+func NewTemplates(overrides map[string]string) (*Templates, error) {
+	t := &Templates{templates: map[string]*template.Template{}}
+	for _, name := range []string{DeploymentTemplate, ServiceTemplate} {
+		text, err := defaultTemplateFiles.ReadFile("templates/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if override, ok := overrides[name]; ok {
+			text = []byte(override)
+		}
+		t.templates[name], err = template.New(name).Funcs(template.FuncMap{"quote": quote}).Option("missingkey=error").Parse(string(text))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name := range overrides {
+		if _, ok := t.templates[name]; !ok {
+			return nil, fmt.Errorf("unknown template %s, expected %s or %s", name, DeploymentTemplate, ServiceTemplate)
+		}
+	}
+
+	sample := &v1beta1.Podinfo{ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default"}}
+	sample.Default()
+	for _, backend := range []bool{false, true} {
+		if _, err := t.PodinfoDeployment(sample, backend, PodinfoVersion); err != nil {
+			return nil, err
+		}
+		if _, err := t.PodinfoService(sample, backend); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// render executes the template and decodes the result into obj, which must be of the expected kind
+func (t *Templates) render(name string, data *TemplateData, gvk schema.GroupVersionKind, obj interface{}) error {
+	var out bytes.Buffer
+	if err := t.templates[name].Execute(&out, data); err != nil {
+		return fmt.Errorf("unable to render %s: %w", name, err)
+	}
+	var typeMeta metav1.TypeMeta
+	if err := yaml.Unmarshal(out.Bytes(), &typeMeta); err != nil {
+		return fmt.Errorf("%s didn't render a valid manifest: %w", name, err)
+	}
+	if typeMeta.GroupVersionKind() != gvk {
+		return fmt.Errorf("%s rendered %s %s, expected %s %s", name, typeMeta.APIVersion, typeMeta.Kind, gvk.GroupVersion(), gvk.Kind)
+	}
+	if err := yaml.UnmarshalStrict(out.Bytes(), obj); err != nil {
+		return fmt.Errorf("%s didn't render a valid %s: %w", name, gvk.Kind, err)
+	}
+	return nil
+}
+
+// quote returns the string as a double quoted YAML scalar
+func quote(s string) (string, error) {
+	quoted, err := json.Marshal(s)
+	return string(quoted), err
+}
+
+// PodinfoDeployment renders the desired deployment of the tier running the given podinfo version. The replicas
+// and the overrides from the spec of the tier are applied before the patches of the tier, the name, namespace,
+// owner, app label and selector of the deployment are enforced.
+func (t *Templates) PodinfoDeployment(podinfo *v1beta1.Podinfo, backend bool, version string) (*appsv1.Deployment, error) {
+	imgSuffix := "-fe"
+	if backend {
+		imgSuffix = "-be"
+	}
+	data := &TemplateData{
+		Podinfo: podinfo.DeepCopy(),
+		Name:    podinfo.Name + imgSuffix,
+		Backend: backend,
+		Version: version,
+		Image:   "ghcr.io/stefanprodan/podinfo:" + version,
+		Level:   Component(podinfo, backend).Config.LogLevel(),
+		Ports:   templatePorts(podinfo, backend),
+	}
+	dep := &appsv1.Deployment{}
+	if err := t.render(DeploymentTemplate, data, appsv1.SchemeGroupVersion.WithKind("Deployment"), dep); err != nil {
+		return nil, err
+	}
+	container := podinfoContainer(&dep.Spec.Template.Spec)
+	if container == nil {
+		return nil, fmt.Errorf("%s rendered a deployment without the %s container", DeploymentTemplate, PodinfoContainer)
+	}
+
+	component := Component(podinfo, backend)
+	if backend && podinfo.Spec.Cache != nil {
+		container.Command = append(container.Command, fmt.Sprintf("--cache-server=tcp://%s:%d", podinfo.Name+"-cache", CachePort))
+	}
+	container.Command = append(container.Command, configFlags(component.Config)...)
+
+	dep.Spec.Replicas = nil
+	if component.Autoscaling == nil {
+		// the replicas of autoscaled tiers are left to the horizontal pod autoscaler
+		replicas := component.ReplicaCount()
+		dep.Spec.Replicas = &replicas
+	}
+	if ui := podinfo.Spec.UI; ui != nil {
+		if ui.Color != "" {
+			setEnv(container, corev1.EnvVar{Name: "PODINFO_UI_COLOR", Value: ui.Color})
+		}
+		if ui.LogoURL != "" {
+			setEnv(container, corev1.EnvVar{Name: "PODINFO_UI_LOGO", Value: ui.LogoURL})
+		}
+		if ui.Path != "" {
+			setEnv(container, corev1.EnvVar{Name: "PODINFO_UI_PATH", Value: ui.Path})
+		}
+	}
+	applyComponentSpec(&dep.Spec.Template.Spec, container, component)
+
+	if len(component.Patches) > 0 {
+		patched := &appsv1.Deployment{}
+		if err := applyPatches(patchesPath(backend), dep, v1beta1.PatchTargetDeployment, component.Patches, patched); err != nil {
+			return nil, err
+		}
+		dep = patched
+	}
+
+	// type meta is required by server-side apply
+	dep.TypeMeta = metav1.TypeMeta{
+		APIVersion: appsv1.SchemeGroupVersion.String(),
+		Kind:       "Deployment",
+	}
+	dep.Name = data.Name
+	dep.Namespace = podinfo.Namespace
+	dep.OwnerReferences = OwnerReferences(podinfo)
+	dep.Labels = withLabel(dep.Labels, "app", data.Name)
+	dep.Labels[ManagedByLabel] = ManagedBy
+	dep.Spec.Selector = &metav1.LabelSelector{
+		MatchLabels: map[string]string{"app": data.Name},
+	}
+	dep.Spec.Template.Labels = withLabel(dep.Spec.Template.Labels, "app", data.Name)
+	dep.Spec.Template.Labels[VersionLabel] = version
+
+	return dep, nil
+}
+
+// PodinfoService renders the service of the tier and applies the patches of the tier to it, its name,
+// namespace, owner and selector are enforced
+func (t *Templates) PodinfoService(podinfo *v1beta1.Podinfo, backend bool) (*corev1.Service, error) {
+	imgSuffix := "-fe"
+	if backend {
+		imgSuffix = "-be"
+	}
+	data := &TemplateData{
+		Podinfo: podinfo.DeepCopy(),
+		Name:    podinfo.Name + imgSuffix,
+		Backend: backend,
+		Level:   Component(podinfo, backend).Config.LogLevel(),
+		Ports:   templatePorts(podinfo, backend),
+	}
+	svc := &corev1.Service{}
+	if err := t.render(ServiceTemplate, data, corev1.SchemeGroupVersion.WithKind("Service"), svc); err != nil {
+		return nil, err
+	}
+
+	if patches := Component(podinfo, backend).Patches; len(patches) > 0 {
+		patched := &corev1.Service{}
+		if err := applyPatches(patchesPath(backend), svc, v1beta1.PatchTargetService, patches, patched); err != nil {
+			return nil, err
+		}
+		svc = patched
+	}
+
+	svc.TypeMeta = metav1.TypeMeta{
+		APIVersion: corev1.SchemeGroupVersion.String(),
+		Kind:       "Service",
+	}
+	svc.Name = data.Name
+	svc.Namespace = podinfo.Namespace
+	svc.OwnerReferences = OwnerReferences(podinfo)
+	svc.Labels = withLabel(svc.Labels, "app", data.Name)
+	svc.Labels[ManagedByLabel] = ManagedBy
+	svc.Spec.Selector = map[string]string{"app": data.Name}
+	return svc, nil
+}
+
+// templatePorts returns the ports of the podinfo servers of the tier
+func templatePorts(podinfo *v1beta1.Podinfo, backend bool) TemplatePorts {
+	config := Component(podinfo, backend).Config
+	return TemplatePorts{
+		HTTP:        config.HTTPPort(),
+		Metrics:     config.MetricsServerPort(),
+		GRPC:        config.GRPCServerPort(),
+		BackendHTTP: podinfo.Spec.Backend.Config.HTTPPort(),
+	}
+}
+
+// configFlags returns the podinfo flags of the config settings that aren't part of the templates, i.e. all but
+// the log level and the ports
+func configFlags(config *v1beta1.PodinfoConfig) []string {
+	if config == nil {
+		return nil
+	}
+	var flags []string
+	if config.H2C {
+		flags = append(flags, "--h2c")
+	}
+	if config.DataPath != "" {
+		flags = append(flags, "--data-path="+config.DataPath)
+	}
+	for _, timeout := range []struct {
+		flag     string
+		duration *metav1.Duration
+	}{
+		{"--http-server-timeout", config.HTTPServerTimeout},
+		{"--http-server-shutdown-timeout", config.HTTPServerShutdownTimeout},
+		{"--http-client-timeout", config.HTTPClientTimeout},
+	} {
+		if timeout.duration != nil {
+			flags = append(flags, fmt.Sprintf("%s=%s", timeout.flag, timeout.duration.Duration))
+		}
+	}
+	if delay := config.RandomDelay; delay != nil {
+		flags = append(flags, "--random-delay", fmt.Sprintf("--random-delay-min=%d", delay.Min))
+		if delay.Max != nil {
+			flags = append(flags, fmt.Sprintf("--random-delay-max=%d", *delay.Max))
+		}
+		if delay.Unit != "" {
+			flags = append(flags, "--random-delay-unit="+delay.Unit)
+		}
+	}
+	if config.RandomError {
+		flags = append(flags, "--random-error")
+	}
+	if config.StressCPU > 0 {
+		flags = append(flags, fmt.Sprintf("--stress-cpu=%d", config.StressCPU))
+	}
+	if config.StressMemory > 0 {
+		flags = append(flags, fmt.Sprintf("--stress-memory=%d", config.StressMemory))
+	}
+	return flags
+}
+
+// patchesPath returns the path of the patches of the tier in the podinfo
+func patchesPath(backend bool) string {
+	if backend {
+		return "spec.backend.patches"
+	}
+	return "spec.frontend.patches"
+}
+
+// withLabel returns the labels with the given label added
+func withLabel(labels map[string]string, key, value string) map[string]string {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[key] = value
+	return labels
+}
@@ -16,249 +16,519 @@ limitations under the License.
 package utils
 
 import (
-	// "fmt"
-	"bytes"
-	"io/ioutil"
+	"fmt"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 
 	quantity "k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
-	k8Yaml "k8s.io/apimachinery/pkg/util/yaml"
 
-	v1alpha1 "github.com/jkremser/podinfo-operator/api/v1alpha1"
+	"github.com/jkremser/podinfo-operator/api/v1beta1"
 )
 
+// PodinfoVersion is the podinfo version deployed when neither the podinfo nor the operator configuration specify one
 const PodinfoVersion = "5.2.1"
 
-func YamlToDeployment(deploymentManifest []byte) (*appsv1.Deployment, error) {
-	d := &appsv1.Deployment{}
-	dec := k8Yaml.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(deploymentManifest)), 10000)
+// CacheImage is the Redis image of the cache tier when the podinfo doesn't specify any
+const CacheImage = "redis:6.0.8"
 
-	if err := dec.Decode(&d); err != nil {
-		return nil, err
+// CachePort is the port the Redis server of the cache tier listens on
+const CachePort = 6379
+
+// PodinfoContainer is the name of the podinfo container of the tier deployments, the overrides from the spec of
+// the tier are applied to it
+const PodinfoContainer = "podinfo"
+
+// VersionLabel is put on the pod template and carries the podinfo version the pods run
+const VersionLabel = "app.kubernetes.io/version"
+
+// ManagedByLabel is put on every object the operator generates, objects without a controller are adopted
+// only if it's set to ManagedBy
+const ManagedByLabel = "app.kubernetes.io/managed-by"
+
+// ManagedBy is the value of ManagedByLabel on the objects generated by the operator
+const ManagedBy = "podinfo-operator"
+
+// OwnerReferences returns the controller owner reference pointing to podinfo, so that the generated
+// objects are garbage collected together with the podinfo custom resource
+func OwnerReferences(podinfo *v1beta1.Podinfo) []metav1.OwnerReference {
+	return []metav1.OwnerReference{
+		*metav1.NewControllerRef(podinfo, v1beta1.GroupVersion.WithKind("Podinfo")),
 	}
-	return d, nil
 }
 
-func PodinfoDeployment(podinfo *v1alpha1.Podinfo, backend bool) *appsv1.Deployment {
-	imgSuffix := "-fe"
+// objectLabels returns the labels of the generated object with the given name, unlike the selectors
+// they carry ManagedByLabel
+func objectLabels(name string) map[string]string {
+	return map[string]string{
+		"app":          name,
+		ManagedByLabel: ManagedBy,
+	}
+}
+
+// Component returns the spec of the backend or frontend tier of the podinfo
+func Component(podinfo *v1beta1.Podinfo, backend bool) *v1beta1.ComponentSpec {
 	if backend {
-		imgSuffix = "-be"
+		return &podinfo.Spec.Backend
+	}
+	return &podinfo.Spec.Frontend
+}
+
+// podinfoContainer returns the podinfo container of the pod, nil if there's none
+func podinfoContainer(pod *corev1.PodSpec) *corev1.Container {
+	for i := range pod.Containers {
+		if pod.Containers[i].Name == PodinfoContainer {
+			return &pod.Containers[i]
+		}
+	}
+	return nil
+}
+
+// applyComponentSpec applies the image, resource, environment and scheduling overrides of the tier to the pod spec
+// and its podinfo container
+func applyComponentSpec(pod *corev1.PodSpec, container *corev1.Container, component *v1beta1.ComponentSpec) {
+	// the deployment must not share anything with the podinfo, it gets overwritten by the API response
+	component = component.DeepCopy()
+	if component.Image != "" {
+		container.Image = component.Image
+	}
+	if component.ImagePullPolicy != "" {
+		container.ImagePullPolicy = component.ImagePullPolicy
+	}
+	if component.Resources != nil {
+		container.Resources = *component.Resources
 	}
+	setEnv(container, component.Env...)
+	container.EnvFrom = append(container.EnvFrom, component.EnvFrom...)
 
+	// the fields the spec leaves empty keep the values from the template
+	if len(component.ImagePullSecrets) > 0 {
+		pod.ImagePullSecrets = component.ImagePullSecrets
+	}
+	if len(component.NodeSelector) > 0 {
+		pod.NodeSelector = component.NodeSelector
+	}
+	if len(component.Tolerations) > 0 {
+		pod.Tolerations = component.Tolerations
+	}
+	if component.Affinity != nil {
+		pod.Affinity = component.Affinity
+	}
+	if len(component.TopologySpreadConstraints) > 0 {
+		pod.TopologySpreadConstraints = component.TopologySpreadConstraints
+	}
+}
+
+// setEnv sets the environment variables of the container, replacing the variables of the same name
+func setEnv(container *corev1.Container, env ...corev1.EnvVar) {
+	for _, e := range env {
+		replaced := false
+		for i := range container.Env {
+			if container.Env[i].Name == e.Name {
+				container.Env[i] = e
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			container.Env = append(container.Env, e)
+		}
+	}
+}
+
+// PodinfoCacheDeployment returns the deployment of the Redis cache (-cache) of the backend,
+// podinfo.Spec.Cache must not be nil
+func PodinfoCacheDeployment(podinfo *v1beta1.Podinfo) *appsv1.Deployment {
+	spec := podinfo.Spec.Cache.DeepCopy()
 	labels := map[string]string{
-		"app": podinfo.Name + imgSuffix,
+		"app": podinfo.Name + "-cache",
+	}
+	image := spec.Image
+	if image == "" {
+		image = CacheImage
+	}
+	resources := corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    quantity.MustParse("1000m"),
+			corev1.ResourceMemory: quantity.MustParse("128Mi"),
+		},
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    quantity.MustParse("100m"),
+			corev1.ResourceMemory: quantity.MustParse("32Mi"),
+		},
+	}
+	if spec.Resources != nil {
+		resources = *spec.Resources
 	}
+	probe := &corev1.Probe{
+		Handler: corev1.Handler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("redis")},
+		},
+		InitialDelaySeconds: 5,
+		TimeoutSeconds:      5,
+	}
+	replicas := int32(1)
 
-	dep := &appsv1.Deployment{
+	return &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+			Kind:       "Deployment",
+		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      podinfo.Name + imgSuffix,
-			Namespace: podinfo.Namespace,
-			Labels:    labels,
+			Name:            podinfo.Name + "-cache",
+			Namespace:       podinfo.Namespace,
+			Labels:          objectLabels(podinfo.Name + "-cache"),
+			OwnerReferences: OwnerReferences(podinfo),
 		},
-
 		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
-					Annotations: map[string]string{
-						"prometheus.io/scrape": "true",
-						"prometheus.io/port":   "9797",
-					},
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{{
-						Image: "ghcr.io/stefanprodan/podinfo:" + PodinfoVersion,
-						Name:  "podinfo",
-
-						Env: []corev1.EnvVar{{
-							Name:  "PODINFO_UI_COLOR",
-							Value: "#34577c",
-						}, {
-							Name:  "PODINFO_UI_MESSAGE",
-							Value: podinfo.Spec.Message,
-						},
-						},
-
+						Name:    "redis",
+						Image:   image,
+						Command: []string{"redis-server", "--port", fmt.Sprint(CachePort)},
 						Ports: []corev1.ContainerPort{{
-							ContainerPort: 9898,
-							Name:          "http",
-						}, {
-							ContainerPort: 9797,
-							Name:          "http-metrics",
-						}, {
-							ContainerPort: 9999,
-							Name:          "grpc",
-						},
-						},
-						Command: []string{
-							"./podinfo",
-							"--port=9898",
-							"--port-metrics=9797",
-							"--level=info",
-							"--backend-url=http://" + podinfo.Name + "-be:9898/echo",
-						},
-						LivenessProbe: &corev1.Probe{
-							Handler: corev1.Handler{
-								Exec: &corev1.ExecAction{
-									Command: []string{
-										"podcli",
-										"check",
-										"http",
-										"localhost:9898/healthz",
-									},
-								},
-							},
-							InitialDelaySeconds: 5,
-							TimeoutSeconds:      5,
-						},
-						ReadinessProbe: &corev1.Probe{
-							Handler: corev1.Handler{
-								Exec: &corev1.ExecAction{
-									Command: []string{
-										"podcli",
-										"check",
-										"http",
-										"localhost:9898/readyz",
-									},
-								},
-							},
-							InitialDelaySeconds: 5,
-							TimeoutSeconds:      5,
-						},
-						Resources: corev1.ResourceRequirements{
-							Limits: corev1.ResourceList{
-								corev1.ResourceCPU:    quantity.MustParse("1000m"),
-								corev1.ResourceMemory: quantity.MustParse("128Mi"),
-							},
-							Requests: corev1.ResourceList{
-								corev1.ResourceCPU:    quantity.MustParse("100m"),
-								corev1.ResourceMemory: quantity.MustParse("32Mi"),
-							},
-						},
-					},
-					},
+							ContainerPort: CachePort,
+							Name:          "redis",
+							Protocol:      corev1.ProtocolTCP,
+						}},
+						LivenessProbe:  probe,
+						ReadinessProbe: probe.DeepCopy(),
+						Resources:      resources,
+					}},
 				},
 			},
 		},
 	}
+}
+
+// PodinfoCacheService returns the service of the Redis cache (-cache) the backend connects to
+func PodinfoCacheService(podinfo *v1beta1.Podinfo) *corev1.Service {
+	labels := map[string]string{
+		"app": podinfo.Name + "-cache",
+	}
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            podinfo.Name + "-cache",
+			Namespace:       podinfo.Namespace,
+			Labels:          objectLabels(podinfo.Name + "-cache"),
+			OwnerReferences: OwnerReferences(podinfo),
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: labels,
+			Ports: []corev1.ServicePort{{
+				Port:       CachePort,
+				Name:       "redis",
+				Protocol:   corev1.ProtocolTCP,
+				TargetPort: intstr.FromString("redis"),
+			}},
+		},
+	}
+}
 
+// PodinfoCacheNetworkPolicy returns the network policy letting only the backend pods reach the cache,
+// podinfo.Spec.NetworkPolicy must not be nil
+func PodinfoCacheNetworkPolicy(podinfo *v1beta1.Podinfo) *networkingv1.NetworkPolicy {
+	labels := map[string]string{
+		"app": podinfo.Name + "-cache",
+	}
+	return &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: networkingv1.SchemeGroupVersion.String(),
+			Kind:       "NetworkPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            podinfo.Name + "-cache",
+			Namespace:       podinfo.Namespace,
+			Labels:          objectLabels(podinfo.Name + "-cache"),
+			OwnerReferences: OwnerReferences(podinfo),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": podinfo.Name + "-be"},
+					},
+				}},
+				Ports: networkPolicyPorts("redis"),
+			}},
+		},
+	}
+}
+
+// HTTPRequestsMetric is the pods metric the custom metrics adapter serves the rate of podinfo's
+// http_requests_total counter as
+const HTTPRequestsMetric = "http_requests"
+
+// PodinfoAutoscaler returns the horizontal pod autoscaler of the tier, the autoscaling of the tier
+// must not be nil
+//
+// TODO: build autoscaling/v2 autoscalers once the Kubernetes libraries are upgraded (v0.23+), v2beta2 is
+// the newest version in v0.20 and it's removed in Kubernetes 1.26. The RBAC rule covers all the versions of
+// the autoscaling group, only the API types here, in the cleanup and in the watch need to change.
+func PodinfoAutoscaler(podinfo *v1beta1.Podinfo, backend bool) *autoscalingv2beta2.HorizontalPodAutoscaler {
+	imgSuffix := "-fe"
 	if backend {
-		// override the command for backend deployment
-		dep.Spec.Template.Spec.Containers[0].Command = []string{
-			"./podinfo",
-			"--port=9898",
-			"--port-metrics=9797",
-			"--level=info",
-			"--grpc-port=9999",
-			"--grpc-service-name=" + podinfo.Name + "-be",
-		}
-		// override the Resources.Limits to follow https://github.com/stefanprodan/podinfo/blob/master/deploy/webapp/backend/deployment.yaml
-		dep.Spec.Template.Spec.Containers[0].Resources.Limits[corev1.ResourceCPU] = quantity.MustParse("2000m")
-		dep.Spec.Template.Spec.Containers[0].Resources.Limits[corev1.ResourceMemory] = quantity.MustParse("512Mi")
-		backend_replicas := int32(podinfo.Spec.BackendReplicas)
-		dep.Spec.Replicas = &backend_replicas
-	} else {
-		frontend_replicas := int32(podinfo.Spec.FrontendReplicas)
-		dep.Spec.Replicas = &frontend_replicas
+		imgSuffix = "-be"
 	}
+	spec := Component(podinfo, backend).Autoscaling.DeepCopy()
 
-	return dep
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: autoscalingv2beta2.SchemeGroupVersion.String(),
+			Kind:       "HorizontalPodAutoscaler",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            podinfo.Name + imgSuffix,
+			Namespace:       podinfo.Namespace,
+			Labels:          objectLabels(podinfo.Name + imgSuffix),
+			OwnerReferences: OwnerReferences(podinfo),
+		},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
+				APIVersion: appsv1.SchemeGroupVersion.String(),
+				Kind:       "Deployment",
+				Name:       podinfo.Name + imgSuffix,
+			},
+			MinReplicas: spec.MinReplicas,
+			MaxReplicas: spec.MaxReplicas,
+		},
+	}
+	if spec.TargetCPUUtilizationPercentage != nil {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, resourceMetric(corev1.ResourceCPU, spec.TargetCPUUtilizationPercentage))
+	}
+	if spec.TargetMemoryUtilizationPercentage != nil {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, resourceMetric(corev1.ResourceMemory, spec.TargetMemoryUtilizationPercentage))
+	}
+	if spec.TargetHTTPRequestsPerSecond != nil {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, autoscalingv2beta2.MetricSpec{
+			Type: autoscalingv2beta2.PodsMetricSourceType,
+			Pods: &autoscalingv2beta2.PodsMetricSource{
+				Metric: autoscalingv2beta2.MetricIdentifier{Name: HTTPRequestsMetric},
+				Target: autoscalingv2beta2.MetricTarget{
+					Type:         autoscalingv2beta2.AverageValueMetricType,
+					AverageValue: spec.TargetHTTPRequestsPerSecond,
+				},
+			},
+		})
+	}
+	return hpa
 }
 
-func PodinfoService(podinfo *v1alpha1.Podinfo, backend bool) *corev1.Service {
-
-	// apiVersion: v1
-	// kind: Service
-	// metadata:
-	//   name: backend
-	//   namespace: webapp
-	// spec:
-	//   type: ClusterIP
-	//   selector:
-	// 	app: backend
-	//   ports:
-	// 	- name: http
-	// 	  port: 9898
-	// 	  protocol: TCP
-	// 	  targetPort: http
-	// 	- port: 9999
-	// 	  targetPort: grpc
-	// 	  protocol: TCP
-	// 	  name: grpc
+func resourceMetric(name corev1.ResourceName, utilization *int32) autoscalingv2beta2.MetricSpec {
+	return autoscalingv2beta2.MetricSpec{
+		Type: autoscalingv2beta2.ResourceMetricSourceType,
+		Resource: &autoscalingv2beta2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingv2beta2.MetricTarget{
+				Type:               autoscalingv2beta2.UtilizationMetricType,
+				AverageUtilization: utilization,
+			},
+		},
+	}
+}
 
+// PodinfoPodDisruptionBudget returns the pod disruption budget of the tier's pods,
+// the component's PodDisruptionBudget must not be nil
+func PodinfoPodDisruptionBudget(podinfo *v1beta1.Podinfo, backend bool) *policyv1beta1.PodDisruptionBudget {
 	imgSuffix := "-fe"
 	if backend {
 		imgSuffix = "-be"
 	}
+	spec := Component(podinfo, backend).PodDisruptionBudget.DeepCopy()
 	labels := map[string]string{
 		"app": podinfo.Name + imgSuffix,
 	}
 
-	svc := &corev1.Service{
+	return &policyv1beta1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: policyv1beta1.SchemeGroupVersion.String(),
+			Kind:       "PodDisruptionBudget",
+		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      podinfo.Name + imgSuffix,
-			Namespace: podinfo.Namespace,
-			Labels:    labels,
+			Name:            podinfo.Name + imgSuffix,
+			Namespace:       podinfo.Namespace,
+			Labels:          objectLabels(podinfo.Name + imgSuffix),
+			OwnerReferences: OwnerReferences(podinfo),
 		},
-		Spec: corev1.ServiceSpec{
-			Type:     corev1.ServiceTypeClusterIP,
-			Selector: labels,
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			MinAvailable:   spec.MinAvailable,
+			MaxUnavailable: spec.MaxUnavailable,
 		},
 	}
+}
+
+// PodinfoNetworkPolicy returns the network policy of the tier's pods, podinfo.Spec.NetworkPolicy must not be nil.
+// The backend accepts the http and grpc traffic only from the frontend pods, the frontend accepts the http
+// traffic from FrontendFrom (or from everywhere if it's empty), the metrics of both tiers are open to MetricsFrom.
+func PodinfoNetworkPolicy(podinfo *v1beta1.Podinfo, backend bool) *networkingv1.NetworkPolicy {
+	imgSuffix := "-fe"
 	if backend {
-		svc.Spec.Ports = []corev1.ServicePort{
-			{
-				Port:       9898,
-				Name:       "http",
-				TargetPort: intstr.FromString("http"),
-			}, {
-				Port:       9999,
-				Name:       "grpc",
-				TargetPort: intstr.FromString("grpc"),
-			},
-		}
+		imgSuffix = "-be"
+	}
+	spec := podinfo.Spec.NetworkPolicy.DeepCopy()
+	labels := map[string]string{
+		"app": podinfo.Name + imgSuffix,
+	}
+
+	var rules []networkingv1.NetworkPolicyIngressRule
+	if backend {
+		rules = append(rules, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{{
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": podinfo.Name + "-fe"},
+				},
+			}},
+			Ports: networkPolicyPorts("http", "grpc"),
+		})
 	} else {
-		svc.Spec.Ports = []corev1.ServicePort{
-			{
-				Port:       80,
-				Name:       "http",
-				Protocol:   corev1.ProtocolTCP,
-				TargetPort: intstr.FromString("http"),
+		rules = append(rules, networkingv1.NetworkPolicyIngressRule{
+			From:  spec.FrontendFrom,
+			Ports: networkPolicyPorts("http"),
+		})
+	}
+	if len(spec.MetricsFrom) > 0 {
+		rules = append(rules, networkingv1.NetworkPolicyIngressRule{
+			From:  spec.MetricsFrom,
+			Ports: networkPolicyPorts("http-metrics"),
+		})
+	}
+
+	return &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: networkingv1.SchemeGroupVersion.String(),
+			Kind:       "NetworkPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            podinfo.Name + imgSuffix,
+			Namespace:       podinfo.Namespace,
+			Labels:          objectLabels(podinfo.Name + imgSuffix),
+			OwnerReferences: OwnerReferences(podinfo),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: labels,
 			},
-		}
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress:     rules,
+		},
 	}
+}
+
+// networkPolicyPorts returns the TCP ports of the podinfo container with the given names
+func networkPolicyPorts(names ...string) []networkingv1.NetworkPolicyPort {
+	ports := make([]networkingv1.NetworkPolicyPort, 0, len(names))
+	for _, name := range names {
+		protocol := corev1.ProtocolTCP
+		port := intstr.FromString(name)
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+	}
+	return ports
+}
+
+// PodinfoIngress returns the ingress routing the traffic for the host and path from the podinfo spec to the
+// frontend service, podinfo.Spec.Ingress must not be nil
+func PodinfoIngress(podinfo *v1beta1.Podinfo) *networkingv1.Ingress {
+	spec := podinfo.Spec.Ingress.DeepCopy()
+	pathType := networkingv1.PathTypePrefix
 
-	return svc
+	ingress := &networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: networkingv1.SchemeGroupVersion.String(),
+			Kind:       "Ingress",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            podinfo.Name + "-fe",
+			Namespace:       podinfo.Namespace,
+			Labels:          objectLabels(podinfo.Name + "-fe"),
+			Annotations:     spec.Annotations,
+			OwnerReferences: OwnerReferences(podinfo),
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: spec.IngressClassName,
+			Rules: []networkingv1.IngressRule{{
+				Host: spec.Host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{{
+							Path:     ingressPath(spec),
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: podinfo.Name + "-fe",
+									Port: networkingv1.ServiceBackendPort{Name: "http"},
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+	if spec.TLSSecretName != "" {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{{
+			Hosts:      []string{spec.Host},
+			SecretName: spec.TLSSecretName,
+		}}
+	}
+	return ingress
 }
 
-func GetDeployment(name string, namespace string, replicas int32, msg string) (*appsv1.Deployment, error) {
-	data, err := ioutil.ReadFile("./resources/deployment.yaml")
-	if err != nil {
-		panic(err)
-	}
-	deployment, e := YamlToDeployment(data)
-	deployment.Name = name
-	deployment.ObjectMeta.Name = name
-	deployment.Namespace = namespace
-	deployment.Spec.Replicas = &replicas
-	deployment.Spec.Selector.MatchLabels["app"] = name
-	if msg != "" {
-		infoMsgEnv := corev1.EnvVar{
-			Name:  "PODINFO_UI_MESSAGE",
-			Value: msg,
+// IngressURL returns the URL the frontend is reachable on through the ingress, the address assigned by
+// the ingress controller is used if the podinfo doesn't specify any host. Empty string is returned until
+// the address is known.
+func IngressURL(podinfo *v1beta1.Podinfo, ingress *networkingv1.Ingress) string {
+	spec := podinfo.Spec.Ingress
+	host := spec.Host
+	if host == "" && ingress != nil {
+		for _, lb := range ingress.Status.LoadBalancer.Ingress {
+			if lb.Hostname != "" {
+				host = lb.Hostname
+				break
+			}
+			if lb.IP != "" {
+				host = lb.IP
+				break
+			}
 		}
-		deployment.Spec.Template.Spec.Containers[0].Env = append(deployment.Spec.Template.Spec.Containers[0].Env, infoMsgEnv)
 	}
-	return deployment, e
+	if host == "" {
+		return ""
+	}
+	scheme := "http"
+	if spec.TLSSecretName != "" {
+		scheme = "https"
+	}
+	return scheme + "://" + host + ingressPath(spec)
 }
 
-func FrontendDeployment() (*appsv1.Deployment, error) {
-	return nil, nil
+func ingressPath(spec *v1beta1.IngressSpec) string {
+	if spec.Path == "" {
+		return "/"
+	}
+	return spec.Path
 }
@@ -3,13 +3,20 @@ module github.com/jkremser/podinfo-operator
 go 1.16
 
 require (
-	github.com/go-logr/logr v0.3.0 // indirect
+	github.com/evanphx/json-patch v4.9.0+incompatible
+	github.com/go-logr/logr v0.3.0
+	github.com/google/gofuzz v1.1.0
 	github.com/onsi/ginkgo v1.14.1
 	github.com/onsi/gomega v1.10.2
+	github.com/prometheus/client_golang v1.7.1
+	github.com/prometheus/client_model v0.2.0
+	github.com/robfig/cron/v3 v3.0.1
 	k8s.io/api v0.20.2
 	k8s.io/apimachinery v0.20.2
 	k8s.io/client-go v0.20.2
+	k8s.io/utils v0.0.0-20210111153108-fddb29f9d009
 	sigs.k8s.io/controller-runtime v0.8.3
+	sigs.k8s.io/yaml v1.2.0
 )
 
 //replace github.com/jkremser/podinfo-operator/api/v1alpha1 => ./podinfo-operator/api/v1alpha1
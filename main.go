@@ -17,22 +17,30 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	infov1alpha1 "github.com/jkremser/podinfo-operator/api/v1alpha1"
+	infov1beta1 "github.com/jkremser/podinfo-operator/api/v1beta1"
 	"github.com/jkremser/podinfo-operator/controllers"
+	"github.com/jkremser/podinfo-operator/controllers/utils"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -45,6 +53,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(infov1alpha1.AddToScheme(scheme))
+	utilruntime.Must(infov1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -52,17 +61,44 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var podinfoVersion string
+	var logFormat string
+	var reconcileTimeout time.Duration
+	var resyncInterval time.Duration
+	var templatesConfigMap string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&podinfoVersion, "podinfo-version", utils.PodinfoVersion,
+		"The podinfo version deployed for the podinfoes that don't specify spec.version.")
+	flag.StringVar(&logFormat, "log-format", "",
+		"The format of the logs, console (human readable) or json (e.g. for log collectors in production). "+
+			"Overrides --zap-encoder when set.")
+	flag.DurationVar(&reconcileTimeout, "reconcile-timeout", 2*time.Minute,
+		"The maximum duration of a single reconciliation, the podinfo is requeued when it runs out of time. 0 disables the timeout.")
+	flag.DurationVar(&resyncInterval, "resync-interval", controllers.DefaultResyncInterval,
+		"The interval of re-examining the podinfoes that are ready. 0 disables the resync.")
+	flag.StringVar(&templatesConfigMap, "templates-configmap", "",
+		"The namespace/name of a ConfigMap with the deployment.yaml and service.yaml templates overriding the embedded ones.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
+	switch logFormat {
+	case "":
+		// keep the encoder chosen by --zap-encoder
+	case "console":
+		zap.ConsoleEncoder()(&opts)
+	case "json":
+		zap.JSONEncoder()(&opts)
+	default:
+		fmt.Fprintf(os.Stderr, "invalid --log-format %q, must be console or json\n", logFormat)
+		os.Exit(1)
+	}
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
@@ -78,13 +114,40 @@ func main() {
 		os.Exit(1)
 	}
 
+	// cancelled when the operator is asked to stop
+	ctx := ctrl.SetupSignalHandler()
+
+	templates := utils.DefaultTemplates()
+	if templatesConfigMap != "" {
+		templates, err = loadTemplates(mgr.GetAPIReader(), templatesConfigMap)
+		if err != nil {
+			setupLog.Error(err, "unable to load the templates", "configMap", templatesConfigMap)
+			os.Exit(1)
+		}
+		setupLog.Info("using the templates from the ConfigMap", "configMap", templatesConfigMap)
+	}
+
 	if err = (&controllers.PodinfoReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Recorder:  controllers.NewDedupRecorder(mgr.GetEventRecorderFor("podinfo-controller"), controllers.EventDeduplicationWindow),
+		Log:       ctrl.Log.WithName("controllers").WithName("Podinfo"),
+		APIReader: mgr.GetAPIReader(),
+
+		DefaultVersion:   podinfoVersion,
+		ReconcileTimeout: reconcileTimeout,
+		ResyncInterval:   resyncInterval,
+		Templates:        templates,
+	}).SetupWithManager(ctx, mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Podinfo")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&infov1beta1.Podinfo{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Podinfo")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -97,8 +160,23 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// loadTemplates reads the templates overriding the embedded ones from the ConfigMap with the given
+// namespace/name, the templates are keyed by their names
+func loadTemplates(reader client.Reader, namespacedName string) (*utils.Templates, error) {
+	parts := strings.SplitN(namespacedName, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid ConfigMap %q, expected namespace/name", namespacedName)
+	}
+	configMap := &corev1.ConfigMap{}
+	err := reader.Get(context.Background(), client.ObjectKey{Namespace: parts[0], Name: parts[1]}, configMap)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewTemplates(configMap.Data)
+}